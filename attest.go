@@ -0,0 +1,241 @@
+package bpi
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+)
+
+// results of patch attestation verification
+const (
+	AttestationPass  = "pass"
+	AttestationFail  = "fail"
+	AttestationNoKey = "no key"
+)
+
+// Attestation is the result of verification of patatt "X-Developer-Signature" header
+type Attestation struct {
+	Status string
+	// Identity is the email address of the developer who signed the patch
+	Identity  string
+	Algorithm string
+	Reason    string
+	// Partial is set if the signature covers only the first bytes of the body set by "l=" tag
+	Partial bool
+}
+
+// DeveloperKeys is a keyring directory of patatt public keys with
+// "<algorithm>/<domain>/<local part>/<selector>" layout, for example
+// "ed25519/example.com/alice/default" with base64 ed25519 key or
+// "openpgp/example.com/alice/default" with armored OpenPGP key.
+type DeveloperKeys struct {
+	dir string
+}
+
+// NewDeveloperKeys creates DeveloperKeys on the keyring directory
+func NewDeveloperKeys(dir string) (*DeveloperKeys, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not open developer keyring")
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("developer keyring %s is not a directory", dir)
+	}
+
+	return &DeveloperKeys{dir: dir}, nil
+}
+
+// Verify checks "X-Developer-Signature" header of the raw message,
+// returns nil if the message isn't attested
+func (k *DeveloperKeys) Verify(raw []byte) *Attestation {
+	headers, _ := splitRawMessage(raw)
+
+	n := -1
+	for i, h := range headers {
+		if strings.EqualFold(headerName(h), "X-Developer-Signature") {
+			n = i
+		}
+	}
+	if n < 0 {
+		return nil
+	}
+
+	tags := parseTagList(headerValue(headers[n]))
+	result := &Attestation{Identity: tags["i"], Algorithm: tags["a"]}
+
+	fail := func(reason string) *Attestation {
+		result.Status = AttestationFail
+		result.Reason = reason
+		return result
+	}
+
+	at := strings.LastIndexByte(result.Identity, '@')
+	if tags["v"] != "1" || at < 0 || tags["h"] == "" || tags["bh"] == "" || tags["b"] == "" {
+		return fail("incorrect signature header")
+	}
+
+	algorithm := strings.TrimSuffix(tags["a"], "-sha256")
+	if algorithm != "ed25519" && algorithm != "openpgp" {
+		return fail("unsupported algorithm " + tags["a"])
+	}
+
+	selector := tags["s"]
+	if selector == "" {
+		selector = "default"
+	}
+
+	canonHeaders, body, err := patattCanonical(raw, headers)
+	if err != nil {
+		return fail(err.Error())
+	}
+
+	if l := tags["l"]; l != "" {
+		length, err := strconv.Atoi(l)
+		if err != nil || length > len(body) {
+			return fail("incorrect body length")
+		}
+
+		// text appended after the length isn't attested
+		result.Partial = length < len(body)
+		body = body[:length]
+	}
+
+	bodyHash := sha256.Sum256(body)
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return fail("body hash mismatch")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fail("incorrect signature")
+	}
+
+	local, domain := result.Identity[:at], result.Identity[at+1:]
+	key, err := ioutil.ReadFile(filepath.Join(k.dir, algorithm, filepath.Base(domain), filepath.Base(local), filepath.Base(selector)))
+	if err != nil {
+		result.Status = AttestationNoKey
+		return result
+	}
+
+	// patatt signs the digest of canonical headers
+	digest := sha256.Sum256(canonicalHeaders(canonHeaders, n, true))
+
+	var signed []byte
+	switch algorithm {
+	case "ed25519":
+		pub, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(key)))
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			return fail("incorrect key")
+		}
+
+		// NaCl signed message is the signature followed by the content
+		if len(sig) < ed25519.SignatureSize || !ed25519.Verify(ed25519.PublicKey(pub), sig[ed25519.SignatureSize:], sig[:ed25519.SignatureSize]) {
+			return fail("signature mismatch")
+		}
+		signed = sig[ed25519.SignatureSize:]
+	case "openpgp":
+		keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+		if err != nil {
+			return fail("incorrect key")
+		}
+
+		md, err := openpgp.ReadMessage(bytes.NewReader(sig), keyring, nil, nil)
+		if err != nil {
+			return fail("incorrect signature")
+		}
+
+		signed, err = ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil || md.SignedBy == nil || md.SignatureError != nil {
+			return fail("signature mismatch")
+		}
+	}
+
+	if !bytes.Equal(signed, digest[:]) {
+		return fail("headers mismatch")
+	}
+
+	result.Status = AttestationPass
+	return result
+}
+
+// patattCanonical returns headers and body of the patch as git am sees them:
+// "From" and "Subject" are replaced with values parsed by git mailinfo,
+// the body is the commit message followed by the patch with CRLF line endings
+func patattCanonical(raw []byte, headers []string) ([]string, []byte, error) {
+	msg, patch, info, err := gitMailinfo(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var body bytes.Buffer
+	content := strings.TrimRight(string(msg)+string(patch), "\r\n")
+	for _, line := range strings.Split(content, "\n") {
+		body.WriteString(strings.TrimRight(line, "\r") + "\r\n")
+	}
+
+	result := make([]string, len(headers))
+	for i, h := range headers {
+		switch strings.ToLower(headerName(h)) {
+		case "from":
+			result[i] = headerName(h) + ": " + info["Author"] + " <" + info["Email"] + ">\r\n"
+		case "subject":
+			result[i] = headerName(h) + ": " + info["Subject"] + "\r\n"
+		default:
+			result[i] = h
+		}
+	}
+
+	return result, body.Bytes(), nil
+}
+
+var mailinfoRe = regexp.MustCompile(`(?m)^([A-Za-z-]+): (.*)$`)
+
+// gitMailinfo splits the email into the commit message, the patch and author info using git mailinfo
+func gitMailinfo(raw []byte) ([]byte, []byte, map[string]string, error) {
+	dir, err := ioutil.TempDir("", "bpi-mailinfo")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	msgPath, patchPath := filepath.Join(dir, "msg"), filepath.Join(dir, "patch")
+	args := []string{"mailinfo", "--encoding=utf-8", "--no-scissors", msgPath, patchPath}
+
+	cmd := exec.Command("git", args...)
+	cmd.Stdin = bytes.NewReader(raw)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, nil, nil, &GitError{Args: args, Stderr: stderr.String(), err: err}
+	}
+
+	info := make(map[string]string)
+	for _, match := range mailinfoRe.FindAllStringSubmatch(string(out), -1) {
+		info[match[1]] = strings.TrimSpace(match[2])
+	}
+
+	msg, err := ioutil.ReadFile(msgPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	patch, err := ioutil.ReadFile(patchPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return msg, patch, info, nil
+}
@@ -12,23 +12,103 @@ import (
 )
 
 func main() {
+	gitDir := flag.String("git", "", "path to local git repository of the project to check patches against")
+	branch := flag.String("branch", "master", "branch of the git repository to check patches against")
+	dkimKeys := flag.String("dkim-keys", "", "path to DKIM key cache file with \"<selector>._domainkey.<domain> <TXT record>\" lines")
+	developerKeys := flag.String("developer-keys", "", "path to patatt keyring directory to verify attestation of patches")
+	address := flag.String("address", "", "email address of the mailing list added to Cc of replies")
+	keyring := flag.String("keyring", "", "path to PGP keyring exported by \"gpg --export\" to verify signed messages")
+	configPath := flag.String("config", "", "path to JSON config with inboxes to serve instead of one repository")
 	flag.Parse()
-	if flag.NArg() != 1 {
-		fmt.Printf("Usage: %s [OPTIONS] path-to-repository\n", os.Args[0])
+	if (*configPath == "" && flag.NArg() != 1) || (*configPath != "" && flag.NArg() != 0) {
+		fmt.Printf("Usage: %s [OPTIONS] path-to-repository\n       %s [OPTIONS] -config path-to-config\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
 	logrus.SetLevel(logrus.DebugLevel)
 
-	loader := bpi.NewDirLoader(flag.Arg(0))
-	store, err := bpi.NewMemStore(loader)
-	if err != nil {
-		logrus.Fatal(err)
+	var storeOpts []bpi.StoreOption
+	if *dkimKeys != "" {
+		keys, err := bpi.NewDKIMKeys(*dkimKeys)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		storeOpts = append(storeOpts, bpi.WithDKIMKeys(keys))
+	}
+
+	if *developerKeys != "" {
+		keys, err := bpi.NewDeveloperKeys(*developerKeys)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		storeOpts = append(storeOpts, bpi.WithDeveloperKeys(keys))
 	}
 
-	server := server.NewHTTPServer(store)
+	var opts []server.Option
+	if *keyring != "" {
+		k, err := bpi.NewKeyring(*keyring)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		opts = append(opts, server.WithKeyring(k))
+	}
+
+	var handler http.Handler
+	if *configPath != "" {
+		config, err := bpi.ReadConfig(*configPath)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		inboxes := make([]*server.Inbox, len(config.Inboxes))
+		for i, c := range config.Inboxes {
+			store, err := bpi.NewMemStore(bpi.NewDirLoader(c.Path), storeOpts...)
+			if err != nil {
+				logrus.Fatalf("inbox %s: %s", c.Name, err)
+			}
+
+			inboxes[i] = &server.Inbox{
+				Name:        c.Name,
+				Description: c.Description,
+				Address:     c.Address,
+				Store:       store,
+			}
+
+			// -git and -branch are defaults for inboxes without own repository
+			repoDir, repoBranch := *gitDir, *branch
+			if c.Git != "" {
+				repoDir = c.Git
+			}
+			if c.Branch != "" {
+				repoBranch = c.Branch
+			}
+			if repoDir != "" {
+				inboxes[i].Options = append(inboxes[i].Options, server.WithRepository(bpi.NewGitRepo(repoDir, repoBranch)))
+			}
+		}
+
+		handler = server.NewMultiServer(inboxes, opts...)
+	} else {
+		store, err := bpi.NewMemStore(bpi.NewDirLoader(flag.Arg(0)), storeOpts...)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+
+		if *gitDir != "" {
+			opts = append(opts, server.WithRepository(bpi.NewGitRepo(*gitDir, *branch)))
+		}
+
+		if *address != "" {
+			opts = append(opts, server.WithListAddress(*address))
+		}
+
+		handler = server.NewHTTPServer(store, opts...)
+	}
 
 	logrus.Info("starting server")
-	http.ListenAndServe("0.0.0.0:8000", server)
+	http.ListenAndServe("0.0.0.0:8000", handler)
 }
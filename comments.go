@@ -0,0 +1,185 @@
+package bpi
+
+import (
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// LineComment is a comment from a reply placed under the quoted line of the patch
+type LineComment struct {
+	// ID is Message-ID of the reply
+	ID     string
+	Author *mail.Address
+	Date   time.Time
+	// File, Hunk and Line are indexes of the commented line in diffs of the patch
+	File int
+	Hunk int
+	Line int
+	Text string
+}
+
+// quoteComment is a comment of a reply with the quoted lines it follows
+type quoteComment struct {
+	Quoted []string
+	Text   string
+}
+
+// quoteComments returns comments interleaved with quotes in the body
+func quoteComments(blocks []*BodyBlock) []*quoteComment {
+	var result []*quoteComment
+	for i := 0; i+1 < len(blocks); i++ {
+		if blocks[i].Type != "quotes" || blocks[i+1].Type != "" {
+			continue
+		}
+
+		text := commentText(blocks[i+1].Body)
+		if text == "" {
+			continue
+		}
+
+		result = append(result, &quoteComment{
+			Quoted: unquoteLines(blocks[i].Body),
+			Text:   text,
+		})
+	}
+
+	return result
+}
+
+// commentText returns text of the comment without signature,
+// comments consisting only of trailers are dropped
+func commentText(body string) string {
+	var lines []string
+	onlyTrailers := true
+	for _, line := range strings.Split(body, "\n") {
+		if line == "-- " {
+			break
+		}
+
+		if strings.TrimSpace(line) != "" && parseTrailer(line) == nil {
+			onlyTrailers = false
+		}
+
+		lines = append(lines, line)
+	}
+
+	if onlyTrailers {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// unquoteLines removes one level of quoting from the lines,
+// lines quoted more than once are replaced with nested quote marker
+func unquoteLines(body string) []string {
+	var result []string
+	for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		line = strings.TrimPrefix(line, ">")
+		if strings.HasPrefix(line, ">") || strings.HasPrefix(line, " >") {
+			result = append(result, ">")
+			continue
+		}
+
+		result = append(result, strings.TrimPrefix(line, " "))
+	}
+
+	return result
+}
+
+// isQuotedDiffLine checks if the unquoted line can be a line of a hunk,
+// empty context lines lose their space when quoted
+func isQuotedDiffLine(line string) bool {
+	if line == "" {
+		return true
+	}
+
+	if strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- ") {
+		return false
+	}
+
+	switch line[0] {
+	case ' ', '+', '-':
+		return true
+	}
+
+	return false
+}
+
+// quotedFile returns name of the file from quoted diff header lines or empty string
+func quotedFile(quoted []string) string {
+	var name string
+	for _, line := range quoted {
+		switch true {
+		case strings.HasPrefix(line, "diff --git "):
+			if fields := strings.Fields(line); len(fields) == 4 {
+				name = trimDiffPath(fields[3])
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if path := trimDiffPath(line[4:]); path != "/dev/null" {
+				name = path
+			}
+		}
+	}
+
+	return name
+}
+
+// findQuotedLine returns indexes of the diff line the comment refers to.
+// The last run of quoted diff lines is searched in hunks, if it isn't found
+// the run is shortened from the beginning down to the last quoted line.
+func findQuotedLine(diffs []*FileDiff, quoted []string) (int, int, int, bool) {
+	start := len(quoted)
+	for start > 0 && isQuotedDiffLine(quoted[start-1]) {
+		start--
+	}
+
+	// trailing empty lines are most likely separators before the comment
+	end := len(quoted)
+	for end > start && quoted[end-1] == "" {
+		end--
+	}
+
+	run := quoted[start:end]
+	if len(run) == 0 {
+		return 0, 0, 0, false
+	}
+
+	name := quotedFile(quoted)
+	for ; len(run) > 0; run = run[1:] {
+		for i, d := range diffs {
+			if name != "" && d.Name() != name {
+				continue
+			}
+
+			for j, h := range d.Hunks {
+				if k := findLinesRun(h.Lines, run); k >= 0 {
+					return i, j, k, true
+				}
+			}
+		}
+	}
+
+	return 0, 0, 0, false
+}
+
+// findLinesRun returns index of the last line of the first occurrence of run in lines or -1
+func findLinesRun(lines, run []string) int {
+	for k := len(run) - 1; k < len(lines); k++ {
+		matched := true
+		for n := range run {
+			line := lines[k-len(run)+1+n]
+			if strings.TrimRight(line, " \t") != strings.TrimRight(run[n], " \t") {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return k
+		}
+	}
+
+	return -1
+}
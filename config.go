@@ -0,0 +1,64 @@
+package bpi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Config lists inboxes served by one server
+type Config struct {
+	Inboxes []*InboxConfig `json:"inboxes"`
+}
+
+// InboxConfig describes a mailing list archive
+type InboxConfig struct {
+	// Name is used in URLs of the inbox
+	Name string `json:"name"`
+	// Path is the directory with messages
+	Path        string `json:"path"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+	// Git is the path to git repository of the project to check patches against
+	Git    string `json:"git"`
+	Branch string `json:"branch"`
+}
+
+var inboxNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ReadConfig reads JSON config file and validates it
+func ReadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read config")
+	}
+
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrap(err, "can not parse config")
+	}
+
+	if len(c.Inboxes) == 0 {
+		return nil, errors.New("no inboxes in config")
+	}
+
+	names := make(map[string]bool)
+	for _, inbox := range c.Inboxes {
+		// names can't look like Message-IDs, top-level paths are looked up in all inboxes
+		if !inboxNameRe.MatchString(inbox.Name) {
+			return nil, errors.Errorf("incorrect inbox name '%s'", inbox.Name)
+		}
+		if names[inbox.Name] {
+			return nil, errors.Errorf("duplicated inbox name '%s'", inbox.Name)
+		}
+		names[inbox.Name] = true
+
+		if inbox.Path == "" {
+			return nil, errors.Errorf("path of inbox '%s' is empty", inbox.Name)
+		}
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,147 @@
+package bpi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Edit operations of a line diff
+const (
+	EditEqual  = ' '
+	EditDelete = '-'
+	EditInsert = '+'
+)
+
+// Edit is one operation of a diff between two lists of strings
+type Edit struct {
+	Op   byte
+	Text string
+}
+
+// DiffStrings returns the shortest edit script transforming a into b
+// using Myers' algorithm
+func DiffStrings(a, b []string) []Edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// trace keeps v[-d..d] after each step d for backtracking
+	var trace [][]int
+	get := func(d, k int) int {
+		return trace[d][k+d]
+	}
+
+loop:
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				break loop
+			}
+		}
+
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	var result []Edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k := x - y
+
+		var prevK int
+		if k == -d || k != d && get(d-1, k-1) < get(d-1, k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+
+		prevX := get(d-1, prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			result = append(result, Edit{EditEqual, a[x-1]})
+			x--
+			y--
+		}
+
+		if x == prevX {
+			result = append(result, Edit{EditInsert, b[y-1]})
+			y--
+		} else {
+			result = append(result, Edit{EditDelete, a[x-1]})
+			x--
+		}
+	}
+
+	for x > 0 && y > 0 {
+		result = append(result, Edit{EditEqual, a[x-1]})
+		x--
+		y--
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+
+	return result
+}
+
+// UnifiedDiff returns the changes between a and b as lines prefixed with ' ', '-' or '+'
+// with the given number of context lines around changes,
+// returns empty string if a and b are equal
+func UnifiedDiff(a, b []string, context int) string {
+	edits := DiffStrings(a, b)
+
+	var lines []string
+	last := -1
+	for i, e := range edits {
+		if e.Op == EditEqual {
+			continue
+		}
+
+		start := i - context
+		if start <= last+1 {
+			start = last + 1
+		} else if len(lines) > 0 {
+			// separate hunks
+			lines = append(lines, "@@")
+		}
+
+		end := i + context
+		if end >= len(edits) {
+			end = len(edits) - 1
+		}
+
+		for j := start; j <= end; j++ {
+			// context after a change can contain other changes
+			if j > i && edits[j].Op != EditEqual {
+				end = j - 1
+				break
+			}
+
+			lines = append(lines, fmt.Sprintf("%c%s", edits[j].Op, edits[j].Text))
+		}
+		last = end
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,88 @@
+package bpi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffStrings(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []string
+		edits string
+	}{
+		{"empty", nil, nil, ""},
+		{"insert into empty", nil, []string{"a", "b"}, "+a +b"},
+		{"delete all", []string{"a", "b"}, nil, "-a -b"},
+		{"identical", []string{"a", "b", "c"}, []string{"a", "b", "c"}, " a  b  c"},
+		{"all changed", []string{"a", "b"}, []string{"c", "d"}, "-a -b +c +d"},
+		{"middle changed", []string{"a", "b", "c"}, []string{"a", "x", "c"}, " a -b +x  c"},
+		{"insert and delete", []string{"a", "b", "c", "d"}, []string{"b", "c", "e", "d"}, "-a  b  c +e  d"},
+	}
+
+	for _, test := range tests {
+		var ops []string
+		for _, e := range DiffStrings(test.a, test.b) {
+			ops = append(ops, string(e.Op)+e.Text)
+		}
+
+		if got := strings.Join(ops, " "); got != test.edits {
+			t.Errorf("%s: expected %q, got %q", test.name, test.edits, got)
+		}
+	}
+}
+
+func TestDiffStringsMinimal(t *testing.T) {
+	a := strings.Split("abcabba", "")
+	b := strings.Split("cbabac", "")
+
+	var changes int
+	var restoredA, restoredB []string
+	for _, e := range DiffStrings(a, b) {
+		switch e.Op {
+		case EditEqual:
+			restoredA = append(restoredA, e.Text)
+			restoredB = append(restoredB, e.Text)
+		case EditDelete:
+			restoredA = append(restoredA, e.Text)
+			changes++
+		case EditInsert:
+			restoredB = append(restoredB, e.Text)
+			changes++
+		}
+	}
+
+	// the example from Myers' paper has the shortest edit script of 5 changes
+	if changes != 5 {
+		t.Errorf("expected 5 changes, got %d", changes)
+	}
+	if !reflect.DeepEqual(restoredA, a) || !reflect.DeepEqual(restoredB, b) {
+		t.Errorf("edit script doesn't transform %v into %v", a, b)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := strings.Split("1 2 3 4 5 6 7 8 9", " ")
+	changed := strings.Split("1 x 3 4 5 6 7 8 y", " ")
+
+	tests := []struct {
+		name    string
+		a, b    []string
+		context int
+		diff    string
+	}{
+		{"empty", nil, nil, 1, ""},
+		{"identical", lines, lines, 1, ""},
+		{"all changed", []string{"a"}, []string{"b"}, 1, "-a\n+b"},
+		{"separate hunks", lines, changed, 1, " 1\n-2\n+x\n 3\n@@\n 8\n-9\n+y"},
+		{"wider context", lines, changed, 2, " 1\n-2\n+x\n 3\n 4\n@@\n 7\n 8\n-9\n+y"},
+		{"joined hunks", lines, changed, 3, " 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+y"},
+	}
+
+	for _, test := range tests {
+		if got := UnifiedDiff(test.a, test.b, test.context); got != test.diff {
+			t.Errorf("%s: expected %q, got %q", test.name, test.diff, got)
+		}
+	}
+}
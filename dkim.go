@@ -0,0 +1,401 @@
+package bpi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"hash"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// results of DKIM verification
+const (
+	DKIMPass = "pass"
+	DKIMFail = "fail"
+	// DKIMNoKey means the key of the signing domain isn't in the key cache
+	DKIMNoKey = "no key"
+)
+
+// DKIMResult is the result of DKIM signature verification of a message
+type DKIMResult struct {
+	Status   string
+	Domain   string
+	Selector string
+	// Aligned is set if the signing domain matches the domain of "From" address
+	Aligned bool
+	// Reason explains failed verification
+	Reason string
+	// Partial is set if the signature covers only the first bytes of the body set by "l=" tag
+	Partial bool
+}
+
+// DKIMKeys is an offline cache of DKIM key records.
+// Each line of the cache file contains DNS name and TXT record like
+// "selector._domainkey.example.com v=DKIM1; k=rsa; p=MIGfMA0...", lines starting with "#" are ignored.
+type DKIMKeys struct {
+	records map[string]string
+}
+
+// NewDKIMKeys reads key cache file
+func NewDKIMKeys(path string) (*DKIMKeys, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read DKIM key cache")
+	}
+	defer f.Close()
+
+	k := &DKIMKeys{records: make(map[string]string)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("incorrect DKIM key cache line: %s", line)
+		}
+
+		// TXT records can be split into quoted strings
+		k.records[strings.ToLower(strings.TrimSuffix(fields[0], "."))] = strings.Replace(strings.Replace(fields[1], `" "`, "", -1), `"`, "", -1)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "can not read DKIM key cache")
+	}
+
+	return k, nil
+}
+
+// LookupTXT returns TXT record by DNS name from the cache
+func (k *DKIMKeys) LookupTXT(name string) (string, bool) {
+	record, ok := k.records[strings.ToLower(name)]
+	return record, ok
+}
+
+// Verify checks DKIM signatures of the raw message sent at the date,
+// returns nil if the message isn't signed.
+// Passed signature of "From" domain is preferred when the message has several signatures.
+func (k *DKIMKeys) Verify(raw []byte, fromDomain string, date time.Time) *DKIMResult {
+	headers, body := splitRawMessage(raw)
+
+	var result *DKIMResult
+	for i, h := range headers {
+		if !strings.EqualFold(headerName(h), "DKIM-Signature") {
+			continue
+		}
+
+		r := k.verifySignature(headers, i, body, date)
+		r.Aligned = r.Domain != "" && (strings.EqualFold(r.Domain, fromDomain) || strings.HasSuffix(strings.ToLower(fromDomain), "."+strings.ToLower(r.Domain)))
+
+		switch true {
+		case result == nil:
+			result = r
+		case r.Status == DKIMPass && (result.Status != DKIMPass || (r.Aligned && !result.Aligned)):
+			result = r
+		}
+	}
+
+	return result
+}
+
+func (k *DKIMKeys) verifySignature(headers []string, n int, body []byte, date time.Time) *DKIMResult {
+	tags := parseTagList(headerValue(headers[n]))
+	result := &DKIMResult{Domain: tags["d"], Selector: tags["s"]}
+
+	fail := func(reason string) *DKIMResult {
+		result.Status = DKIMFail
+		result.Reason = reason
+		return result
+	}
+
+	if tags["v"] != "1" || tags["d"] == "" || tags["s"] == "" || tags["h"] == "" || tags["b"] == "" || tags["bh"] == "" {
+		return fail("incorrect signature")
+	}
+
+	// RFC 6376 requires "From" header to be signed
+	signed := false
+	for _, name := range strings.Split(tags["h"], ":") {
+		if strings.EqualFold(strings.TrimSpace(name), "From") {
+			signed = true
+			break
+		}
+	}
+	if !signed {
+		return fail("From header isn't signed")
+	}
+
+	if x := tags["x"]; x != "" {
+		expires, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			return fail("incorrect expiration time")
+		}
+
+		if t, err := strconv.ParseInt(tags["t"], 10, 64); err == nil && expires < t {
+			return fail("incorrect expiration time")
+		}
+
+		// archived messages are checked at the time they were sent, not at the time they are read
+		if !date.IsZero() && date.Unix() > expires {
+			return fail("signature was expired when the message was sent")
+		}
+	}
+
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	algorithm := strings.SplitN(tags["a"], "-", 2)
+	if len(algorithm) != 2 {
+		return fail("unsupported algorithm " + tags["a"])
+	}
+	switch algorithm[1] {
+	case "sha256":
+		newHash, cryptoHash = sha256.New, crypto.SHA256
+	case "sha1":
+		newHash, cryptoHash = sha1.New, crypto.SHA1
+	default:
+		return fail("unsupported algorithm " + tags["a"])
+	}
+
+	headerCanon, bodyCanon := "simple", "simple"
+	if c := tags["c"]; c != "" {
+		parts := strings.SplitN(c, "/", 2)
+		headerCanon = parts[0]
+		if len(parts) == 2 {
+			bodyCanon = parts[1]
+		}
+	}
+
+	canonBody := canonicalBody(body, bodyCanon == "relaxed")
+	if l := tags["l"]; l != "" {
+		length, err := strconv.Atoi(l)
+		if err != nil || length > len(canonBody) {
+			return fail("incorrect body length")
+		}
+
+		// text appended after the length isn't signed
+		result.Partial = length < len(canonBody)
+		canonBody = canonBody[:length]
+	}
+
+	h := newHash()
+	h.Write(canonBody)
+	if base64.StdEncoding.EncodeToString(h.Sum(nil)) != tags["bh"] {
+		return fail("body hash mismatch")
+	}
+
+	record, ok := k.LookupTXT(tags["s"] + "._domainkey." + tags["d"])
+	if !ok {
+		result.Status = DKIMNoKey
+		return result
+	}
+
+	key := parseTagList(record)
+	if key["p"] == "" {
+		return fail("key is revoked")
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(key["p"])
+	if err != nil {
+		return fail("incorrect key")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return fail("incorrect signature")
+	}
+
+	h = newHash()
+	h.Write(canonicalHeaders(headers, n, headerCanon == "relaxed"))
+	hashed := h.Sum(nil)
+
+	switch algorithm[0] {
+	case "rsa":
+		if key["k"] != "" && key["k"] != "rsa" {
+			return fail("key type mismatch")
+		}
+
+		rsaKey, err := parseRSAKey(pub)
+		if err != nil {
+			return fail("incorrect key")
+		}
+
+		if err := rsa.VerifyPKCS1v15(rsaKey, cryptoHash, hashed, sig); err != nil {
+			return fail("signature mismatch")
+		}
+	case "ed25519":
+		if key["k"] != "ed25519" || len(pub) != ed25519.PublicKeySize {
+			return fail("key type mismatch")
+		}
+
+		if !ed25519.Verify(ed25519.PublicKey(pub), hashed, sig) {
+			return fail("signature mismatch")
+		}
+	default:
+		return fail("unsupported algorithm " + tags["a"])
+	}
+
+	result.Status = DKIMPass
+	return result
+}
+
+func parseRSAKey(der []byte) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKIXPublicKey(der); err == nil {
+		if rsaKey, ok := key.(*rsa.PublicKey); ok {
+			return rsaKey, nil
+		}
+
+		return nil, errors.New("not an RSA key")
+	}
+
+	return x509.ParsePKCS1PublicKey(der)
+}
+
+// splitRawMessage returns header fields with folding and the body of the message using CRLF line endings
+func splitRawMessage(raw []byte) ([]string, []byte) {
+	raw = bytes.Replace(raw, []byte("\r\n"), []byte("\n"), -1)
+	raw = bytes.Replace(raw, []byte("\n"), []byte("\r\n"), -1)
+
+	var header, body []byte
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		header, body = raw[:i+2], raw[i+4:]
+	} else {
+		header = raw
+	}
+
+	var headers []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1] += line
+			continue
+		}
+
+		headers = append(headers, line)
+	}
+
+	return headers, body
+}
+
+func headerName(h string) string {
+	if i := strings.IndexByte(h, ':'); i >= 0 {
+		return strings.TrimSpace(h[:i])
+	}
+
+	return ""
+}
+
+func headerValue(h string) string {
+	if i := strings.IndexByte(h, ':'); i >= 0 {
+		return h[i+1:]
+	}
+
+	return ""
+}
+
+var wspRe = regexp.MustCompile(`[ \t]+`)
+
+// canonicalBody canonicalizes the body with "simple" or "relaxed" algorithm (RFC 6376 3.4)
+func canonicalBody(body []byte, relaxed bool) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	if relaxed {
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(wspRe.ReplaceAllString(line, " "), " ")
+		}
+	}
+
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+
+	if end == 0 {
+		if relaxed {
+			return nil
+		}
+
+		return []byte("\r\n")
+	}
+
+	return []byte(strings.Join(lines[:end], "\r\n") + "\r\n")
+}
+
+// canonicalHeaders returns signed header fields selected by "h=" tag of the n-th header
+// followed by the signature header without "b=" value (RFC 6376 3.7)
+func canonicalHeaders(headers []string, n int, relaxed bool) []byte {
+	canon := func(h string) string {
+		if !relaxed {
+			return h
+		}
+
+		value := strings.Replace(strings.Replace(headerValue(h), "\r\n", "", -1), "\n", "", -1)
+		value = strings.TrimSpace(wspRe.ReplaceAllString(value, " "))
+		return strings.ToLower(headerName(h)) + ":" + value + "\r\n"
+	}
+
+	var result strings.Builder
+	used := make(map[int]bool)
+	for _, name := range strings.Split(parseTagList(headerValue(headers[n]))["h"], ":") {
+		name = strings.TrimSpace(name)
+		// the last unused instance of the header is signed
+		for i := len(headers) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(headerName(headers[i]), name) {
+				used[i] = true
+				result.WriteString(canon(headers[i]))
+				break
+			}
+		}
+	}
+
+	result.WriteString(strings.TrimSuffix(canon(removeSignatureValue(headers[n])), "\r\n"))
+
+	return []byte(result.String())
+}
+
+// removeSignatureValue removes value of "b=" tag from DKIM-Signature header keeping the rest as is
+func removeSignatureValue(h string) string {
+	i := strings.IndexByte(h, ':')
+	tags := strings.Split(h[i+1:], ";")
+	for j, tag := range tags {
+		if eq := strings.IndexByte(tag, '='); eq >= 0 && strings.TrimSpace(tag[:eq]) == "b" {
+			tags[j] = tag[:eq+1]
+			// the header field may end with the tag
+			if strings.HasSuffix(tag, "\r\n") {
+				tags[j] += "\r\n"
+			}
+		}
+	}
+
+	return h[:i+1] + strings.Join(tags, ";")
+}
+
+// parseTagList parses "tag=value; ..." list, whitespace is removed from values
+func parseTagList(s string) map[string]string {
+	result := make(map[string]string)
+	for _, tag := range strings.Split(s, ";") {
+		eq := strings.IndexByte(tag, '=')
+		if eq < 0 {
+			continue
+		}
+
+		name := strings.TrimSpace(tag[:eq])
+		value := strings.Join(strings.Fields(tag[eq+1:]), "")
+		result[name] = value
+	}
+
+	return result
+}
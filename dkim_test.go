@@ -0,0 +1,206 @@
+package bpi
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const dkimTestMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: list@example.org\r\n" +
+	"Subject: [PATCH] foo: add baz\r\n" +
+	"\r\n" +
+	"Add baz.\r\n"
+
+// signDKIM adds ed25519 DKIM-Signature of example.com with the tags to the message
+func signDKIM(key ed25519.PrivateKey, msg string, tags string) string {
+	headers, body := splitRawMessage([]byte(msg))
+
+	bh := sha256.Sum256(canonicalBody(body, true))
+	signature := "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed; d=example.com; s=test; " +
+		tags + "; bh=" + base64.StdEncoding.EncodeToString(bh[:]) + "; b="
+
+	headers = append([]string{signature + "\r\n"}, headers...)
+	hashed := sha256.Sum256(canonicalHeaders(headers, 0, true))
+	b := ed25519.Sign(key, hashed[:])
+
+	return signature + base64.StdEncoding.EncodeToString(b) + "\r\n" + msg
+}
+
+func TestDKIMVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := &DKIMKeys{records: map[string]string{
+		"test._domainkey.example.com": "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub),
+	}}
+
+	// the message is sent long before the test runs
+	date := time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)
+	sent := date.Unix()
+
+	tests := []struct {
+		name       string
+		raw        string
+		fromDomain string
+		status     string
+		reason     string
+		aligned    bool
+		partial    bool
+	}{
+		{
+			name:       "pass",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject"),
+			fromDomain: "example.com",
+			status:     DKIMPass,
+			aligned:    true,
+		},
+		{
+			name:       "body hash mismatch",
+			raw:        strings.Replace(signDKIM(key, dkimTestMessage, "h=from:to:subject"), "Add baz.", "Add qux.", 1),
+			fromDomain: "example.com",
+			status:     DKIMFail,
+			reason:     "body hash mismatch",
+			aligned:    true,
+		},
+		{
+			name:       "from isn't signed",
+			raw:        signDKIM(key, dkimTestMessage, "h=to:subject"),
+			fromDomain: "example.com",
+			status:     DKIMFail,
+			reason:     "From header isn't signed",
+			aligned:    true,
+		},
+		{
+			name:       "misaligned domain",
+			raw:        signDKIM(key, strings.Replace(dkimTestMessage, "alice@example.com", "alice@example.org", 1), "h=from:to:subject"),
+			fromDomain: "example.org",
+			status:     DKIMPass,
+			aligned:    false,
+		},
+		{
+			name:       "subdomain is aligned",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject"),
+			fromDomain: "lists.example.com",
+			status:     DKIMPass,
+			aligned:    true,
+		},
+		{
+			name:       "not expired when sent",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject; t="+strconv.FormatInt(sent, 10)+"; x="+strconv.FormatInt(sent+3600, 10)),
+			fromDomain: "example.com",
+			status:     DKIMPass,
+			aligned:    true,
+		},
+		{
+			name:       "expired when sent",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject; t="+strconv.FormatInt(sent-7200, 10)+"; x="+strconv.FormatInt(sent-3600, 10)),
+			fromDomain: "example.com",
+			status:     DKIMFail,
+			reason:     "signature was expired when the message was sent",
+			aligned:    true,
+		},
+		{
+			name:       "whole body length",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject; l=10"),
+			fromDomain: "example.com",
+			status:     DKIMPass,
+			aligned:    true,
+		},
+		{
+			name:       "text appended after body length",
+			raw:        signDKIM(key, dkimTestMessage, "h=from:to:subject; l=10") + "Add qux.\r\n",
+			fromDomain: "example.com",
+			status:     DKIMPass,
+			aligned:    true,
+			partial:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := keys.Verify([]byte(test.raw), test.fromDomain, date)
+			if r == nil {
+				t.Fatal("signature isn't found")
+			}
+
+			if r.Status != test.status || r.Reason != test.reason {
+				t.Errorf("expected %q (%q), got %q (%q)", test.status, test.reason, r.Status, r.Reason)
+			}
+
+			if r.Aligned != test.aligned {
+				t.Errorf("expected aligned %v, got %v", test.aligned, r.Aligned)
+			}
+
+			if r.Partial != test.partial {
+				t.Errorf("expected partial %v, got %v", test.partial, r.Partial)
+			}
+		})
+	}
+}
+
+func TestDKIMVerifyUnsigned(t *testing.T) {
+	keys := &DKIMKeys{records: map[string]string{}}
+	if r := keys.Verify([]byte(dkimTestMessage), "example.com", time.Time{}); r != nil {
+		t.Errorf("expected no result, got %q", r.Status)
+	}
+}
+
+// rfc8463Message is the example message of RFC 8463 Appendix A signed with ed25519 and RSA keys
+const rfc8463Message = "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+	" subject : date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+	" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+	"DKIM-Signature: v=1; a=rsa-sha256; c=relaxed/relaxed;\r\n" +
+	" d=football.example.com; i=@football.example.com;\r\n" +
+	" q=dns/txt; s=test; t=1528637909; h=from : to : subject :\r\n" +
+	" date : message-id : from : subject : date;\r\n" +
+	" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+	" b=F45dVWDfMbQDGHJFlXUNB2HKfbCeLRyhDXgFpEL8GwpsRe0IeIixNTe3\r\n" +
+	" DhCVlUrSjV4BwcVcOF6+FF3Zo9Rpo1tFOeS9mPYQTnGdaSGsgeefOsk2Jz\r\n" +
+	" dA+L10TeYt9BgDfQNZtKdN1WO//KgIqXP7OdEFE4LjFYNcUxZQ4FADY+8=\r\n" +
+	"From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+func TestDKIMVerifyRFC8463(t *testing.T) {
+	records := map[string]string{
+		"brisbane._domainkey.football.example.com": "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+		"test._domainkey.football.example.com": "v=DKIM1; k=rsa; p=MIGfMA0GCSqGSIb3DQEBAQUAA4GNADCBiQKBgQDkHlOQoBTzWR" +
+			"iGs5V6NpP3idY6Wk08a5qhdR6wy5bdOKb2jLQiY/J16JYi0Qvx/byYzCNb3W91y3FutAC" +
+			"DfzwQ/BC/e/8uBsCR+yz1Lxj+PL6lHvqMKrM3rG4hstT5QjvHO9PzoxZyVYLzBfO2EeC3" +
+			"Ip3G+2kryOTIKT+l/K4w3QIDAQAB",
+	}
+
+	headers, body := splitRawMessage([]byte(rfc8463Message))
+	for i, selector := range []string{"brisbane", "test"} {
+		t.Run(selector, func(t *testing.T) {
+			// only the key of the tested signature is known
+			name := selector + "._domainkey.football.example.com"
+			keys := &DKIMKeys{records: map[string]string{name: records[name]}}
+
+			r := keys.verifySignature(headers, i, body, time.Time{})
+			if r.Status != DKIMPass || r.Domain != "football.example.com" || r.Selector != selector {
+				t.Errorf("expected pass of %s, got %q (%q) of %s", selector, r.Status, r.Reason, r.Selector)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package bpi
+
+import (
+	"github.com/pkg/errors"
+)
+
+// NotFoundError is returned when a message or another requested object doesn't exist
+type NotFoundError struct {
+	// Kind is what was requested, for example "message" or "series"
+	Kind string
+	ID   string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Kind + " '" + e.ID + "' not found"
+}
+
+// IsNotFound returns true if the cause of the error is NotFoundError
+func IsNotFound(err error) bool {
+	_, ok := errors.Cause(err).(*NotFoundError)
+	return ok
+}
+
+// ErrNotReady is returned when an index required for the request is still being built
+var ErrNotReady = errors.New("index is not ready yet")
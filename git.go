@@ -0,0 +1,234 @@
+package bpi
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// GitRepo is a local git repository of the project discussed in the mailing list
+type GitRepo struct {
+	dir string
+	// Branch is the branch patches are checked against
+	Branch string
+
+	applyMu    sync.Mutex
+	applyCache map[string]*ApplyResult
+}
+
+// NewGitRepo creates new GitRepo on dir path, patches are checked against the branch
+func NewGitRepo(dir, branch string) *GitRepo {
+	return &GitRepo{
+		dir:        dir,
+		Branch:     branch,
+		applyCache: make(map[string]*ApplyResult),
+	}
+}
+
+// git runs git command in the repository with optional input and extra environment variables
+func (r *GitRepo) git(stdin io.Reader, env []string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	cmd.Stdin = stdin
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return out, &GitError{Args: args, Stderr: stderr.String(), err: err}
+	}
+
+	return out, nil
+}
+
+// GitError is returned when git command fails
+type GitError struct {
+	Args   []string
+	Stderr string
+	err    error
+}
+
+func (e *GitError) Error() string {
+	return "git " + strings.Join(e.Args, " ") + ": " + e.err.Error() + ": " + strings.TrimSpace(e.Stderr)
+}
+
+// ResolveBlobs returns full ids of blobs by abbreviated ids,
+// blobs that are not found in the repository are missing in the result
+func (r *GitRepo) ResolveBlobs(abbrevs []string) (map[string]string, error) {
+	var input bytes.Buffer
+	for _, abbrev := range abbrevs {
+		input.WriteString(abbrev + "^{blob}\n")
+	}
+
+	out, err := r.git(&input, nil, "cat-file", "--batch-check=%(objectname)")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for i := 0; scanner.Scan() && i < len(abbrevs); i++ {
+		// not found objects are reported as "<name> missing" or "<name> ambiguous"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 1 {
+			result[abbrevs[i]] = fields[0]
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+// ApplyResult is the result of checking a patch against the repository
+type ApplyResult struct {
+	// Branch the patch was checked against
+	Branch string
+	// BaseFound is true if all pre-image blobs from "index" lines exist in the repository
+	BaseFound bool
+	// AppliesToBase is true if the patch applies to the tree of its pre-image blobs
+	AppliesToBase bool
+	// Applies is true if the patch applies cleanly to the branch
+	Applies bool
+	// Conflicts contains files the patch doesn't apply to if git reports them
+	Conflicts []string
+}
+
+var applyErrorRe = regexp.MustCompile(`^error: (?:patch failed: (.+):\d+|(.+): (?:does not exist in index|already exists in index|patch does not apply|does not match index))$`)
+
+// CheckApply checks if the patches of the message apply to the branch,
+// returns nil if the message doesn't contain patches.
+// Results are cached until the branch moves.
+func (r *GitRepo) CheckApply(m *Message) (*ApplyResult, error) {
+	diffs, err := m.Diffs()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(diffs) == 0 {
+		return nil, nil
+	}
+
+	out, err := r.git(nil, nil, "rev-parse", "--verify", r.Branch+"^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	tip := strings.TrimSpace(string(out))
+
+	key := m.ID + " " + tip
+	r.applyMu.Lock()
+	res, ok := r.applyCache[key]
+	r.applyMu.Unlock()
+	if ok {
+		return res, nil
+	}
+
+	res = &ApplyResult{Branch: r.Branch}
+
+	var abbrevs []string
+	for _, d := range diffs {
+		if d.OldIndex != "" && strings.Trim(d.OldIndex, "0") != "" {
+			abbrevs = append(abbrevs, d.OldIndex)
+		}
+	}
+
+	blobs, err := r.ResolveBlobs(abbrevs)
+	if err != nil {
+		return nil, err
+	}
+	res.BaseFound = len(blobs) == len(abbrevs)
+
+	if res.BaseFound {
+		res.AppliesToBase, _, err = r.applyCheck(diffs, func(env []string) error {
+			return r.baseIndex(env, diffs, blobs)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res.Applies, res.Conflicts, err = r.applyCheck(diffs, func(env []string) error {
+		_, err := r.git(nil, env, "read-tree", tip)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.applyMu.Lock()
+	r.applyCache[key] = res
+	r.applyMu.Unlock()
+
+	return res, nil
+}
+
+// applyCheck runs git apply --check of the diffs against temporary index filled by prepare,
+// any failure of git apply means the diffs don't apply, returns files with conflicts reported by git
+func (r *GitRepo) applyCheck(diffs []*FileDiff, prepare func(env []string) error) (bool, []string, error) {
+	// git creates the index file, an empty file isn't a valid index
+	dir, err := ioutil.TempDir("", "bpi-index")
+	if err != nil {
+		return false, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+	if err := prepare(env); err != nil {
+		return false, nil, errors.Wrap(err, "can not prepare index")
+	}
+
+	var patch bytes.Buffer
+	for _, d := range diffs {
+		patch.WriteString(d.String() + "\n")
+	}
+
+	_, err = r.git(&patch, env, "apply", "--cached", "--check", "-")
+	if err == nil {
+		return true, nil, nil
+	}
+
+	gitErr, ok := err.(*GitError)
+	if !ok {
+		return false, nil, err
+	}
+
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(gitErr.Stderr, "\n") {
+		m := applyErrorRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+
+		file := m[1] + m[2]
+		if !seen[file] {
+			seen[file] = true
+			conflicts = append(conflicts, file)
+		}
+	}
+
+	return false, conflicts, nil
+}
+
+// baseIndex fills the index with pre-image blobs of the diffs
+func (r *GitRepo) baseIndex(env []string, diffs []*FileDiff, blobs map[string]string) error {
+	var input bytes.Buffer
+	for _, d := range diffs {
+		if full, ok := blobs[d.OldIndex]; ok {
+			input.WriteString("100644 " + full + "\t" + d.OldName + "\n")
+		}
+	}
+
+	_, err := r.git(&input, env, "update-index", "--index-info")
+	return err
+}
@@ -1,6 +1,7 @@
 package bpi
 
 import (
+	"io/ioutil"
 	"net/mail"
 	"os"
 	"path/filepath"
@@ -14,6 +15,8 @@ type MailLoader interface {
 	All() ([]*mail.Message, error)
 	// One returns message by Message-ID
 	One(id string) (*mail.Message, error)
+	// Raw returns message as it was received by Message-ID
+	Raw(id string) ([]byte, error)
 }
 
 // DirLoader implements MailLoader recursively scanning directory with emails per file
@@ -69,12 +72,22 @@ func (l *DirLoader) All() ([]*mail.Message, error) {
 func (l *DirLoader) One(id string) (*mail.Message, error) {
 	path, ok := l.idToPath[id]
 	if !ok {
-		return nil, errors.Errorf("mbox for id: '%s' not found", id)
+		return nil, &NotFoundError{Kind: "message", ID: id}
 	}
 
 	return parseMsgFile(path)
 }
 
+// Raw implements MailLoader interface, returns message file content by Message-ID
+func (l *DirLoader) Raw(id string) ([]byte, error) {
+	path, ok := l.idToPath[id]
+	if !ok {
+		return nil, &NotFoundError{Kind: "message", ID: id}
+	}
+
+	return ioutil.ReadFile(path)
+}
+
 func parseMsgFile(path string) (*mail.Message, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -0,0 +1,411 @@
+package bpi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// mergeIndexDepth is the maximum number of commits per branch scanned for merged patches
+const mergeIndexDepth = 10000
+
+// mergeIndexInterval is the minimal time between checks of branches for changes
+const mergeIndexInterval = time.Minute
+
+// Commit is a commit of the repository that merged a patch
+type Commit struct {
+	SHA    string
+	Branch string
+	Title  string
+}
+
+// MergeIndex maps mailed patches to the commits that merged them.
+// Patches are matched by patch-id and by "Link:" and "Message-Id:" trailers of commits.
+// The index is rebuilt in background when branches change.
+type MergeIndex struct {
+	repo  *GitRepo
+	store Store
+
+	mu sync.Mutex
+	// checked is the time of the last check of branches
+	checked  time.Time
+	building bool
+	// refs is the state of branches the index was built for
+	refs      string
+	byMessage map[string]*Commit
+	byCommit  map[string]string
+
+	// patchIDs caches patch-ids of patches by Message-ID, empty for patches without diffs,
+	// it's used only by rebuild which never runs concurrently
+	patchIDs map[string]string
+}
+
+// NewMergeIndex creates new MergeIndex of patches from the store merged into the repository,
+// the index is built in background
+func NewMergeIndex(repo *GitRepo, store Store) *MergeIndex {
+	i := &MergeIndex{
+		repo:     repo,
+		store:    store,
+		patchIDs: make(map[string]string),
+	}
+	i.update()
+
+	return i
+}
+
+// Commit returns commit that merged the message by Message-ID or nil
+func (i *MergeIndex) Commit(id string) *Commit {
+	i.update()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.byMessage[id]
+}
+
+var commitSHARe = regexp.MustCompile(`^[0-9a-fA-F]{4,40}$`)
+
+// Message returns Message-ID of the patch merged as the commit, sha can be abbreviated
+func (i *MergeIndex) Message(sha string) (string, error) {
+	if !commitSHARe.MatchString(sha) {
+		return "", &NotFoundError{Kind: "commit", ID: sha}
+	}
+
+	i.update()
+
+	out, err := i.repo.git(nil, nil, "rev-parse", "--verify", "--quiet", sha+"^{commit}")
+	if err != nil {
+		return "", &NotFoundError{Kind: "commit", ID: sha}
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	id, ok := i.byCommit[strings.TrimSpace(string(out))]
+	if !ok {
+		return "", &NotFoundError{Kind: "patch merged as commit", ID: sha}
+	}
+
+	return id, nil
+}
+
+// update starts rebuild of the index in background
+// if branches weren't checked for mergeIndexInterval
+func (i *MergeIndex) update() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.building || time.Since(i.checked) < mergeIndexInterval {
+		return
+	}
+
+	i.building = true
+	go func() {
+		if err := i.rebuild(); err != nil {
+			logrus.Errorf("can not build merge index: %s", err)
+		}
+
+		i.mu.Lock()
+		i.checked = time.Now()
+		i.building = false
+		i.mu.Unlock()
+	}()
+}
+
+// rebuild rebuilds the index if branches have changed
+func (i *MergeIndex) rebuild() error {
+	out, err := i.repo.git(nil, nil, "for-each-ref", "--format=%(objectname) %(refname:short)", "refs/heads")
+	if err != nil {
+		return err
+	}
+	refs := string(out)
+
+	i.mu.Lock()
+	changed := refs != i.refs
+	i.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	// the configured branch goes first so commits are attributed to it
+	branches := []string{i.repo.Branch}
+	for _, line := range strings.Split(strings.TrimSpace(refs), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] != i.repo.Branch {
+			branches = append(branches, fields[1])
+		}
+	}
+
+	byPatchID := make(map[string]*Commit)
+	var indexed []*indexedCommit
+
+	for n, branch := range branches {
+		args := []string{branch, "--no-merges", fmt.Sprintf("--max-count=%d", mergeIndexDepth)}
+		if n > 0 {
+			// commits of the previous branches are already indexed
+			args = append(args, "--not")
+			args = append(args, branches[:n]...)
+		}
+
+		commits, err := i.commits(branch, args)
+		if err != nil {
+			return err
+		}
+
+		indexed = append(indexed, commits...)
+
+		patchIDs, err := i.repo.patchIDs(append([]string{"log", "-p", "--format=commit %H"}, args...))
+		if err != nil {
+			return err
+		}
+
+		for _, c := range commits {
+			if patchID, ok := patchIDs[c.SHA]; ok {
+				if _, ok := byPatchID[patchID]; !ok {
+					byPatchID[patchID] = c.Commit
+				}
+			}
+		}
+	}
+
+	byMessage, byCommit, err := i.matchPatches(indexed, byPatchID)
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("merge index: %d patches merged", len(byMessage))
+
+	i.mu.Lock()
+	i.refs = refs
+	i.byMessage = byMessage
+	i.byCommit = byCommit
+	i.mu.Unlock()
+
+	return nil
+}
+
+// matchPatches matches all patches from the store to commits by trailers and patch-id,
+// returns commits by Message-ID and Message-IDs by commit
+func (i *MergeIndex) matchPatches(commits []*indexedCommit, byPatchID map[string]*Commit) (map[string]*Commit, map[string]string, error) {
+	patches, err := i.store.Patches()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byMessage := make(map[string]*Commit)
+	byCommit := make(map[string]string)
+
+	known := make(map[string]bool)
+	for _, p := range patches {
+		known[p.ID] = true
+	}
+
+	for _, c := range commits {
+		for _, id := range c.ids {
+			if known[id] {
+				if _, ok := byMessage[id]; !ok {
+					byMessage[id] = c.Commit
+				}
+				if _, ok := byCommit[c.SHA]; !ok {
+					byCommit[c.SHA] = id
+				}
+			}
+		}
+	}
+
+	if err := i.updatePatchIDs(patches); err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range patches {
+		c, ok := byPatchID[i.patchIDs[p.ID]]
+		if !ok {
+			continue
+		}
+
+		if _, ok := byMessage[p.ID]; !ok {
+			byMessage[p.ID] = c
+		}
+		if _, ok := byCommit[c.SHA]; !ok {
+			byCommit[c.SHA] = p.ID
+		}
+	}
+
+	return byMessage, byCommit, nil
+}
+
+// updatePatchIDs computes patch-ids of patches missing in the cache
+// by one git patch-id call using fake commit ids
+func (i *MergeIndex) updatePatchIDs(patches []*MessageHeader) error {
+	var input bytes.Buffer
+	ids := make(map[string]string)
+	for n, p := range patches {
+		if _, ok := i.patchIDs[p.ID]; ok {
+			continue
+		}
+
+		diffs, err := patchDiffs(i.store, p.ID)
+		if err != nil {
+			logrus.Warnf("can not parse patch '%s': %s", p.ID, err)
+			i.patchIDs[p.ID] = ""
+			continue
+		}
+
+		if len(diffs) == 0 {
+			i.patchIDs[p.ID] = ""
+			continue
+		}
+
+		fake := fmt.Sprintf("%040x", n+1)
+		ids[fake] = p.ID
+		input.WriteString("commit " + fake + "\n")
+		for _, d := range diffs {
+			input.WriteString(d.String() + "\n")
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	out, err := i.repo.git(&input, nil, "patch-id", "--stable")
+	if err != nil {
+		return err
+	}
+
+	patchIDs := parsePatchIDs(out)
+	for fake, id := range ids {
+		i.patchIDs[id] = patchIDs[fake]
+	}
+
+	return nil
+}
+
+type indexedCommit struct {
+	*Commit
+	// ids are Message-IDs from "Link:" and "Message-Id:" trailers
+	ids []string
+}
+
+// commits returns commits selected by git log arguments with Message-IDs from their trailers
+func (i *MergeIndex) commits(branch string, args []string) ([]*indexedCommit, error) {
+	out, err := i.repo.git(nil, nil, append([]string{"log", "--format=%H%x00%B%x00"}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*indexedCommit
+	parts := strings.Split(string(out), "\x00")
+	for n := 0; n+1 < len(parts); n += 2 {
+		sha := strings.TrimSpace(parts[n])
+		body := parts[n+1]
+
+		title := body
+		if end := strings.IndexByte(body, '\n'); end >= 0 {
+			title = body[:end]
+		}
+
+		c := &indexedCommit{Commit: &Commit{SHA: sha, Branch: branch, Title: title}}
+		for _, line := range strings.Split(body, "\n") {
+			t := parseTrailer(line)
+			if t == nil {
+				continue
+			}
+
+			switch true {
+			case t.Is("Link"):
+				if id := linkMessageID(t.Value); id != "" {
+					c.ids = append(c.ids, id)
+				}
+			case t.Is("Message-Id"):
+				if id := getID(strings.TrimSpace(t.Value)); id != "" {
+					c.ids = append(c.ids, id)
+				}
+			}
+		}
+
+		result = append(result, c)
+	}
+
+	return result, nil
+}
+
+// linkMessageID returns Message-ID from the last path element of archive url
+// like https://lore.kernel.org/r/<Message-ID>
+func linkMessageID(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	id := path[strings.LastIndexByte(path, '/')+1:]
+	if !strings.Contains(id, "@") {
+		return ""
+	}
+
+	return id
+}
+
+// patchDiffs returns diffs of the patch by Message-ID
+// without loading replies to it like Store.Get does
+func patchDiffs(store Store, id string) ([]*FileDiff, error) {
+	m, err := store.Message(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Diffs()
+}
+
+// patchIDs streams output of git command to git patch-id,
+// returns patch-id by commit
+func (r *GitRepo) patchIDs(args []string) (map[string]string, error) {
+	cmd := exec.Command("git", append([]string{"-C", r.dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	out, err := r.git(stdout, nil, "patch-id", "--stable")
+	// unblocks the command if git patch-id exits early
+	stdout.Close()
+	if waitErr := cmd.Wait(); waitErr != nil && err == nil {
+		err = &GitError{Args: args, Stderr: stderr.String(), err: waitErr}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePatchIDs(out), nil
+}
+
+// parsePatchIDs parses "<patch-id> <commit>" lines of git patch-id output
+func parsePatchIDs(out []byte) map[string]string {
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			result[fields[1]] = fields[0]
+		}
+	}
+
+	return result
+}
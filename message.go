@@ -2,8 +2,12 @@ package bpi
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/mail"
+	"regexp"
 	"strings"
 	"time"
 
@@ -17,22 +21,52 @@ type MessageHeader struct {
 	Title   string
 	Author  *mail.Address
 	Date    time.Time
-	To      string
-	Cc      string
+	To      []*mail.Address
+	Cc      []*mail.Address
+	// Patch is set if the subject looks like a patch or a cover letter
+	Patch *PatchInfo
+	// DKIM is the result of DKIM verification at ingest, nil if the message isn't signed or verification is disabled
+	DKIM *DKIMResult
 }
 
 // Message contains headers of a message and body as a list of blocks
 type Message struct {
 	*MessageHeader
 
+	// Sender is the author from the message headers,
+	// Author can be overridden by the in-body header for patches sent on behalf of somebody else
+	Sender *mail.Address
+	// AuthorDate is the date from in-body header or Date of the message
+	AuthorDate time.Time
+	// InBody is set if the body starts with in-body header
+	InBody *InBodyHeader
+
 	Body      []*BodyBlock
 	SignedOff bool
+	// Trailers contains trailers of the message like "Signed-off-by"
+	Trailers []*Trailer
+	// Reviews contains review trailers like "Reviewed-by" given in replies to the message
+	Reviews []*Trailer
+	// Comments contains comments from replies placed under the quoted lines of the patch
+	Comments []*LineComment
+	// SignOff is the result of sign-off check, set only for messages with a patch
+	SignOff *SignOffCheck
+	// PGP is set for messages signed with PGP/MIME or inline PGP signature
+	PGP *PGPSignature
+	// Attestation is the result of patatt signature verification, nil if the patch isn't attested or verification is disabled
+	Attestation *Attestation
 }
 
 // BodyBlock represents part of message body
 type BodyBlock struct {
 	Type string
 	Body string
+	// Level is the depth of quotes block, 1 for "> text", 2 for "> > text" or ">> text"
+	Level int
+	// Attribution contains lines like "On ... X wrote:" introducing quotes block as they appear in the body
+	Attribution string
+	// Source is set for quotes block if the quoted text is found in an ancestor message
+	Source *QuoteSource
 }
 
 // NewMessageHeader parses mail.Message to MessageHeader
@@ -49,33 +83,19 @@ func NewMessageHeader(mm *mail.Message) (*MessageHeader, error) {
 		return nil, err
 	}
 
-	var to string
+	var to []*mail.Address
 	if mm.Header.Get("To") != "" {
-		toList, err := mail.ParseAddressList(mm.Header.Get("To"))
+		to, err = mail.ParseAddressList(mm.Header.Get("To"))
 		if err != nil {
 			return nil, err
 		}
-
-		names := make([]string, len(toList))
-		for i, addr := range toList {
-			names[i] = addr.Name
-		}
-
-		to = strings.Join(names, ", ")
 	}
 
-	var cc string
+	var cc []*mail.Address
 	if mm.Header.Get("Cc") != "" {
-		ccList, err := mail.ParseAddressList(mm.Header.Get("Cc"))
+		cc, err = mail.ParseAddressList(mm.Header.Get("Cc"))
 		// just skip incorrect CC
-		if err == nil {
-			names := make([]string, len(ccList))
-			for i, addr := range ccList {
-				names[i] = addr.Name
-			}
-
-			cc = strings.Join(names, ", ")
-		} else {
+		if err != nil {
 			logrus.Warnf("incorrect cc in message '%s': %s", mm.Header.Get("Message-Id"), mm.Header.Get("Cc"))
 		}
 	}
@@ -88,6 +108,7 @@ func NewMessageHeader(mm *mail.Message) (*MessageHeader, error) {
 		Title:   subject,
 		To:      to,
 		Cc:      cc,
+		Patch:   ParsePatchSubject(subject),
 	}
 
 	return h, nil
@@ -102,27 +123,84 @@ func NewMessage(mm *mail.Message) (*Message, error) {
 
 	m := &Message{MessageHeader: h}
 
-	blocks, _, err := parseBody(mm.Body)
+	body, err := ioutil.ReadAll(mm.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	m.PGP, body, err = parsePGP(mm.Header, body)
+	if err != nil {
+		logrus.Warnf("can not parse PGP signature of message '%s': %s", h.ID, err)
+	}
+
+	blocks, trailers, err := parseBody(bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
 
 	m.Body = blocks
+	m.Trailers = trailers
+	for _, t := range trailers {
+		if t.Is("Signed-off-by") {
+			m.SignedOff = true
+		}
+	}
+
+	hasPatch := false
+	for _, b := range blocks {
+		if b.Type == "patch" {
+			hasPatch = true
+			break
+		}
+	}
+
+	m.Sender = h.Author
+	m.AuthorDate = h.Date
+	// in-body "From:" or "Subject:" lines in regular messages are just text
+	if (m.Patch != nil || hasPatch) && len(blocks) > 0 && blocks[0].Type == "" {
+		m.InBody = parseInBodyHeader(blocks[0])
+	}
+	if m.InBody != nil {
+		if m.InBody.Author != nil {
+			m.Author = m.InBody.Author
+		}
+		if !m.InBody.Date.IsZero() {
+			m.AuthorDate = m.InBody.Date
+		}
+		if m.InBody.Title != "" && m.Patch != nil {
+			if p := ParsePatchSubject(m.InBody.Title); p != nil {
+				m.Patch.Title = p.Title
+			} else {
+				m.Patch.Title = m.InBody.Title
+			}
+		}
+	}
+
+	if hasPatch {
+		m.SignOff = checkSignOff(trailers, m.Author, m.Sender)
+	}
 
 	return m, nil
 }
 
-func parseBody(body io.Reader) ([]*BodyBlock, bool, error) {
+func parseBody(body io.Reader) ([]*BodyBlock, []*Trailer, error) {
 	state := ""
 	inQuotes := "inQuotes"
 	inPatch := "inPatch"
+	inSignature := "inSignature"
+	inArmor := "inArmor"
+	inFooter := "inFooter"
+	// armorEnd is the prefix of the line closing current PGP armor,
+	// empty means armor headers end with an empty line
+	armorEnd := ""
 
-	var signedOff bool
+	var trailers []*Trailer
 	var blocks []*BodyBlock
 	currentBlock := &BodyBlock{}
 
 	newBlock := func(t string) {
-		if currentBlock != nil {
+		// skip empty text blocks, for example at the beginning of the body
+		if currentBlock != nil && (currentBlock.Type != "" || currentBlock.Body != "") {
 			blocks = append(blocks, currentBlock)
 		}
 		currentBlock = &BodyBlock{
@@ -135,12 +213,33 @@ func parseBody(body io.Reader) ([]*BodyBlock, bool, error) {
 		line := scanner.Text()
 
 		switch true {
-		case state == "" && strings.HasPrefix(line, "Signed-off-by:"):
-			signedOff = true // FIXME: most probably need to compare with From
+		case state == inArmor:
+			currentBlock.Body = currentBlock.Body + line + "\n"
+			if (armorEnd == "" && line == "") || (armorEnd != "" && strings.HasPrefix(line, armorEnd)) {
+				state = ""
+				newBlock("")
+			}
+		case state != inFooter && state != inPatch && isListFooter(line):
+			state = inFooter
+			newBlock("footer")
+			currentBlock.Body = currentBlock.Body + line + "\n"
+		case state != inFooter && state != inPatch && strings.HasPrefix(line, "-----BEGIN PGP "):
+			state = inArmor
+			armorEnd = "-----END PGP "
+			if strings.HasPrefix(line, "-----BEGIN PGP SIGNED MESSAGE-----") {
+				armorEnd = ""
+			}
+			newBlock("pgp")
+			currentBlock.Body = currentBlock.Body + line + "\n"
+		case (state == "" || state == inQuotes) && line == "-- ":
+			state = inSignature
+			newBlock("signature")
+			currentBlock.Body = currentBlock.Body + line + "\n"
 		case state == "" && strings.HasPrefix(line, ">"):
 			// start new quotes block
 			state = inQuotes
 			newBlock("quotes")
+			currentBlock.Level = quoteLevel(line)
 			currentBlock.Body = currentBlock.Body + line + "\n"
 		case state == "" && patchbreak(line):
 			state = inPatch
@@ -150,19 +249,258 @@ func parseBody(body io.Reader) ([]*BodyBlock, bool, error) {
 			state = ""
 			newBlock("")
 			currentBlock.Body = currentBlock.Body + line + "\n"
+		case state == inQuotes && quoteLevel(line) != currentBlock.Level:
+			// nested quotes start or end
+			newBlock("quotes")
+			currentBlock.Level = quoteLevel(line)
+			currentBlock.Body = currentBlock.Body + line + "\n"
 		default:
 			currentBlock.Body = currentBlock.Body + line + "\n"
 		}
+
+		// checked after the switch to find trailers right after closed quotes
+		if state == "" {
+			if t := parseTrailer(line); t != nil {
+				trailers = append(trailers, t)
+			}
+		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, false, err
+		return nil, nil, err
 	}
 
-	if currentBlock != nil {
+	if currentBlock != nil && (currentBlock.Type != "" || currentBlock.Body != "" || len(blocks) == 0) {
 		blocks = append(blocks, currentBlock)
 	}
 
-	return blocks, signedOff, nil
+	return attachAttributions(blocks), trailers, nil
+}
+
+// listFooterMinLen is the minimal length of underscores line starting mailing list footer
+const listFooterMinLen = 20
+
+// isListFooter checks if the line is a separator of footer added by mailing list software like Mailman
+func isListFooter(line string) bool {
+	return len(line) >= listFooterMinLen && strings.Trim(line, "_") == ""
+}
+
+// Dimmed checks if the block is a signature, a mailing list footer or PGP armor,
+// such blocks are shown dimmed and aren't a part of the message text
+func (b *BodyBlock) Dimmed() bool {
+	switch b.Type {
+	case "signature", "footer", "pgp":
+		return true
+	}
+
+	return false
+}
+
+// Text returns text of the message for search indexing without signatures, footers and PGP armor
+func (m *Message) Text() string {
+	var result strings.Builder
+	for _, b := range m.Body {
+		if !b.Dimmed() {
+			result.WriteString(b.Body)
+		}
+	}
+
+	return result.String()
+}
+
+// quoteLevel returns number of quote marks at the beginning of the line
+func quoteLevel(line string) int {
+	level := 0
+	for i := 0; i < len(line); i++ {
+		switch true {
+		case line[i] == '>':
+			level++
+		case line[i] == ' ' && i+1 < len(line) && line[i+1] == '>':
+			// "> > text" style
+		default:
+			return level
+		}
+	}
+
+	return level
+}
+
+var attributionRe = regexp.MustCompile(`(?i)(wrote|writes|said|a écrit|schrieb)\s*:\s*$`)
+
+// attachAttributions moves attribution lines preceding quotes blocks into the blocks,
+// blocks left empty without own attribution are removed
+func attachAttributions(blocks []*BodyBlock) []*BodyBlock {
+	var result []*BodyBlock
+	for i, b := range blocks {
+		if b.Type == "quotes" && i > 0 {
+			prev := blocks[i-1]
+			if prev.Type == "" || (prev.Type == "quotes" && prev.Level < b.Level) {
+				b.Attribution, prev.Body = splitAttribution(prev.Body)
+				if b.Attribution != "" && prev.Attribution == "" && strings.TrimSpace(strings.Replace(prev.Body, ">", "", -1)) == "" {
+					result = result[:len(result)-1]
+				}
+			}
+		}
+
+		result = append(result, b)
+	}
+
+	return result
+}
+
+// splitAttribution cuts attribution lines from the end of the text,
+// the attribution can be wrapped to two lines starting with "On"
+func splitAttribution(text string) (string, string) {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	end := len(lines)
+	for end > 0 && strings.TrimSpace(strings.TrimLeft(lines[end-1], "> ")) == "" {
+		end--
+	}
+	if end == 0 || !attributionRe.MatchString(lines[end-1]) {
+		return "", text
+	}
+
+	start := end - 1
+	first := strings.TrimLeft(lines[start], "> ")
+	if !strings.HasPrefix(first, "On ") && start > 0 && strings.HasPrefix(strings.TrimLeft(lines[start-1], "> "), "On ") {
+		start--
+	}
+
+	attribution := strings.Join(lines[start:end], "\n") + "\n"
+	rest := strings.Join(lines[:start], "\n")
+	if rest != "" {
+		rest += "\n"
+	}
+
+	return attribution, rest
+}
+
+// InBodyHeader contains "From:", "Date:" and "Subject:" lines from the beginning of the body.
+// git format-patch adds them for patches sent on behalf of somebody else.
+type InBodyHeader struct {
+	Author *mail.Address
+	Date   time.Time
+	Title  string
+}
+
+// parseInBodyHeader parses and removes in-body header lines from the block,
+// returns nil if there are none
+func parseInBodyHeader(b *BodyBlock) *InBodyHeader {
+	lines := strings.Split(b.Body, "\n")
+
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+
+	h := &InBodyHeader{}
+	end := start
+loop:
+	for ; end < len(lines); end++ {
+		line := lines[end]
+		switch true {
+		case strings.HasPrefix(line, "From: "):
+			author, err := mail.ParseAddress(line[6:])
+			if err != nil {
+				return nil
+			}
+			h.Author = author
+		case strings.HasPrefix(line, "Date: "):
+			date, err := mail.ParseDate(line[6:])
+			if err != nil {
+				return nil
+			}
+			h.Date = date
+		case strings.HasPrefix(line, "Subject: "):
+			h.Title = strings.TrimSpace(line[9:])
+		default:
+			break loop
+		}
+	}
+
+	// in-body header must be separated from the message by an empty line
+	if end == start || end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+		return nil
+	}
+
+	if end < len(lines) {
+		end++
+	}
+	b.Body = strings.Join(lines[end:], "\n")
+
+	return h
+}
+
+// Diffs returns parsed diffs from all patch blocks of the message
+func (m *Message) Diffs() ([]*FileDiff, error) {
+	var result []*FileDiff
+	for _, b := range m.Body {
+		if b.Type != "patch" {
+			continue
+		}
+
+		diffs, err := ParseDiff(b.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, diffs...)
+	}
+
+	return result, nil
+}
+
+// SentByOther returns true if the patch author isn't the sender of the message
+func (m *Message) SentByOther() bool {
+	return !strings.EqualFold(m.Author.Address, m.Sender.Address)
+}
+
+// Recipients are addresses of a reply
+type Recipients struct {
+	To *mail.Address
+	Cc []*mail.Address
+}
+
+// ReplyRecipients returns addresses a reply-to-all is sent to:
+// the sender of the message and all its recipients including the patch author
+func (m *Message) ReplyRecipients() *Recipients {
+	seen := map[string]bool{strings.ToLower(m.Sender.Address): true}
+
+	var cc []*mail.Address
+	for _, addr := range append(append([]*mail.Address{m.Author}, m.To...), m.Cc...) {
+		key := strings.ToLower(addr.Address)
+		if !seen[key] {
+			seen[key] = true
+			cc = append(cc, addr)
+		}
+	}
+
+	return &Recipients{To: m.Sender, Cc: cc}
+}
+
+// HeaderField is a header field of the message as it was received
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// RawHeaderFields returns header fields of the raw message in order,
+// folded values are unfolded and encoded words are decoded
+func RawHeaderFields(raw []byte) []*HeaderField {
+	headers, _ := splitRawMessage(raw)
+
+	var decoder mime.WordDecoder
+	result := make([]*HeaderField, 0, len(headers))
+	for _, h := range headers {
+		value := strings.TrimSpace(strings.Replace(headerValue(h), "\r\n", "", -1))
+		if decoded, err := decoder.DecodeHeader(value); err == nil {
+			value = decoded
+		}
+
+		result = append(result, &HeaderField{Name: headerName(h), Value: value})
+	}
+
+	return result
 }
 
 func getID(id string) string {
@@ -0,0 +1,69 @@
+package bpi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBody(t *testing.T) {
+	body := `On Mon, Alice wrote:
+> Add baz.
+Reviewed-by: Bob <bob@example.com>
+
+Looks good.
+Acked-by: Carol <carol@example.com>
+` + "-- \nBob\n"
+
+	blocks, trailers, err := parseBody(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, b := range blocks {
+		types = append(types, b.Type)
+	}
+	if got := strings.Join(types, ","); got != "quotes,,signature" {
+		t.Errorf("expected quotes, text and signature blocks, got %q", got)
+	}
+
+	var keys []string
+	for _, tr := range trailers {
+		keys = append(keys, tr.Key)
+	}
+	if got := strings.Join(keys, ","); got != "Reviewed-by,Acked-by" {
+		t.Errorf("expected trailers after quotes and in text, got %q", got)
+	}
+}
+
+func TestParseBodyPatch(t *testing.T) {
+	body := `Add baz.
+
+Signed-off-by: Alice <alice@example.com>
+---
+diff --git a/foo b/foo
+--- a/foo
++++ b/foo
+@@ -1 +1,2 @@
+ foo
++Reviewed-by: nobody
+____________________________________
+-----BEGIN PGP SIGNATURE-----
+`
+
+	blocks, trailers, err := parseBody(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(blocks) != 2 || blocks[0].Type != "" || blocks[1].Type != "patch" {
+		t.Fatalf("expected text and patch blocks, got %d blocks", len(blocks))
+	}
+	if !strings.HasSuffix(blocks[1].Body, "-----BEGIN PGP SIGNATURE-----\n") {
+		t.Errorf("lines looking like a footer or PGP armor aren't kept in the patch")
+	}
+
+	if len(trailers) != 1 || !trailers[0].Is("Signed-off-by") {
+		t.Errorf("expected only Signed-off-by trailer, got %d trailers", len(trailers))
+	}
+}
@@ -2,6 +2,8 @@ package bpi
 
 import (
 	"bufio"
+	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
@@ -41,9 +43,295 @@ func patchbreak(line string) bool {
 	return false
 }
 
+// FileDiff represents diff of one file in a patch
+type FileDiff struct {
+	// Header contains "diff -" line and extended header lines
+	Header []string
+	// OldName and NewName are paths from "--- " and "+++ " lines without a/ b/ prefixes
+	OldName string
+	NewName string
+	// OldIndex and NewIndex are abbreviated blob ids from "index " line
+	OldIndex string
+	NewIndex string
+	Hunks    []*Hunk
+}
+
+// Hunk represents one "@@ -a,b +c,d @@" part of a file diff
+type Hunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	// Section is the text after the closing "@@", usually a function name
+	Section string
+	// Lines contains hunk lines with ' ', '+' or '-' prefix
+	// and "\ No newline at end of file" markers after the last lines of the file
+	Lines []string
+}
+
+// Name returns path of the file after the change or before it for deleted files
+func (d *FileDiff) Name() string {
+	if d.NewName == "" || d.NewName == "/dev/null" {
+		return d.OldName
+	}
+
+	return d.NewName
+}
+
+// Stat returns number of added and deleted lines
+func (d *FileDiff) Stat() (added int, deleted int) {
+	for _, h := range d.Hunks {
+		for _, line := range h.Lines {
+			switch line[0] {
+			case '+':
+				added++
+			case '-':
+				deleted++
+			}
+		}
+	}
+
+	return added, deleted
+}
+
+// Apply applies hunks of the diff to the pre-image content and returns post-image content.
+// Hunks are looked up near their positions if the pre-image has lines added or removed.
+func (d *FileDiff) Apply(content []byte) ([]byte, error) {
+	lines := splitLines(content)
+
+	var result []string
+	// pos is the next line of the pre-image to copy
+	pos := 0
+	// noNewline is set if the last line of the post-image in the hunk has no newline
+	noNewline := false
+	for _, h := range d.Hunks {
+		var oldLines, newLines []string
+		var prev byte
+		noNewline = false
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				oldLines = append(oldLines, line[1:])
+				newLines = append(newLines, line[1:])
+			case '-':
+				oldLines = append(oldLines, line[1:])
+			case '+':
+				newLines = append(newLines, line[1:])
+			case '\\':
+				// the marker of a deleted line doesn't affect the post-image
+				noNewline = prev != '-'
+			}
+			prev = line[0]
+		}
+
+		// hunks without old lines insert after OldStart line
+		expected := h.OldStart - 1
+		if h.OldLines == 0 {
+			expected = h.OldStart
+		}
+
+		start := findLines(lines, oldLines, expected, pos)
+		if start < 0 {
+			return nil, errors.Errorf("hunk %s doesn't apply to %s", h.Header(), d.OldName)
+		}
+
+		result = append(result, lines[pos:start]...)
+		result = append(result, newLines...)
+		pos = start + len(oldLines)
+	}
+	rest := lines[pos:]
+	result = append(result, rest...)
+
+	if len(result) == 0 {
+		return []byte{}, nil
+	}
+
+	switch true {
+	case len(rest) > 0 && content[len(content)-1] != '\n':
+		// the pre-image ends without a newline after the last hunk
+		return []byte(strings.Join(result, "\n")), nil
+	case len(rest) == 0 && noNewline:
+		return []byte(strings.Join(result, "\n")), nil
+	}
+
+	return []byte(strings.Join(result, "\n") + "\n"), nil
+}
+
+// splitLines splits content into lines without line endings
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+// findLines returns position of needle in lines closest to the expected one
+// but not before min or -1 if not found
+func findLines(lines, needle []string, expected, min int) int {
+	if expected < min {
+		expected = min
+	}
+
+	matches := func(start int) bool {
+		if start < min || start+len(needle) > len(lines) {
+			return false
+		}
+
+		for i, line := range needle {
+			if lines[start+i] != line {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	for offset := 0; expected-offset >= min || expected+offset <= len(lines); offset++ {
+		if matches(expected - offset) {
+			return expected - offset
+		}
+
+		if matches(expected + offset) {
+			return expected + offset
+		}
+	}
+
+	return -1
+}
+
+// AddedLines returns numbers of lines in the post-image added by the diff
+func (d *FileDiff) AddedLines() []int {
+	var result []int
+	for _, h := range d.Hunks {
+		n := h.NewStart
+		for _, line := range h.Lines {
+			switch line[0] {
+			case ' ':
+				n++
+			case '+':
+				result = append(result, n)
+				n++
+			}
+		}
+	}
+
+	return result
+}
+
+// HeaderLines returns header lines of the diff including "---" and "+++" lines
+func (d *FileDiff) HeaderLines() []string {
+	lines := append([]string{}, d.Header...)
+	if d.OldName != "" || d.NewName != "" {
+		lines = append(lines, "--- "+diffPath("a/", d.OldName), "+++ "+diffPath("b/", d.NewName))
+	}
+
+	return lines
+}
+
+// String returns text representation of the diff
+func (d *FileDiff) String() string {
+	lines := d.HeaderLines()
+	for _, h := range d.Hunks {
+		lines = append(lines, h.Header())
+		lines = append(lines, h.Lines...)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Header returns "@@ -a,b +c,d @@ section" line of the hunk
+func (h *Hunk) Header() string {
+	header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+	if h.Section != "" {
+		header += " " + h.Section
+	}
+
+	return header
+}
+
+func hunkRange(start, lines int) string {
+	if lines == 1 {
+		return strconv.Itoa(start)
+	}
+
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+func diffPath(prefix, name string) string {
+	if name == "/dev/null" {
+		return name
+	}
+
+	return prefix + name
+}
+
+func trimDiffPath(path string) string {
+	// drop timestamp that GNU diff adds after a tab
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i]
+	}
+
+	if path == "/dev/null" {
+		return path
+	}
+
+	if len(path) > 2 && path[1] == '/' && (path[0] == 'a' || path[0] == 'b') {
+		return path[2:]
+	}
+
+	return path
+}
+
+// parseHunkHeader parses "@@ -a,b +c,d @@ section" line
+func parseHunkHeader(line string) (*Hunk, error) {
+	parts := strings.SplitN(line, "@@", 3)
+	if len(parts) != 3 {
+		return nil, errors.Errorf("incorrect hunk header: %s", line)
+	}
+
+	ranges := strings.Fields(parts[1])
+	if len(ranges) != 2 || ranges[0][0] != '-' || ranges[1][0] != '+' {
+		return nil, errors.Errorf("incorrect hunk header: %s", line)
+	}
+
+	h := &Hunk{Section: strings.TrimSpace(parts[2])}
+
+	var err error
+	h.OldStart, h.OldLines, err = parseHunkRange(ranges[0][1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect hunk header: %s", line)
+	}
+
+	h.NewStart, h.NewLines, err = parseHunkRange(ranges[1][1:])
+	if err != nil {
+		return nil, errors.Wrapf(err, "incorrect hunk header: %s", line)
+	}
+
+	return h, nil
+}
+
+func parseHunkRange(r string) (int, int, error) {
+	lines := 1
+	parts := strings.SplitN(r, ",", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(parts) == 2 {
+		lines, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return start, lines, nil
+}
+
 // ParseDiff parses git diff into list of diffs per file
 //
-// TODO: some other git headers
+// TODO: other git headers are kept in FileDiff.Header but not interpreted
 // "old mode "
 // "new mode "
 // "deleted file mode "
@@ -58,13 +346,14 @@ func patchbreak(line string) bool {
 // "dissimilarity index "
 //
 // FIXME: GNU diff add "\n" lines as empty context lines
-func ParseDiff(input string) ([]string, error) {
+func ParseDiff(input string) ([]*FileDiff, error) {
 	if input == "" {
 		return nil, nil
 	}
 
-	var diffs [][]string
-	var currentDiff []string
+	var diffs []*FileDiff
+	var currentDiff *FileDiff
+	var currentHunk *Hunk
 
 	inHeader := "inHeader"
 	inHunk := "inHunk"
@@ -82,48 +371,65 @@ func ParseDiff(input string) ([]string, error) {
 			// new diff
 			state = inHeader
 
-			if len(currentDiff) > 0 {
+			if currentDiff != nil {
 				diffs = append(diffs, currentDiff)
 			}
-			currentDiff = []string{}
-
-			currentDiff = append(currentDiff, line)
+			currentDiff = &FileDiff{Header: []string{line}}
+			currentHunk = nil
 		case state == "":
 			// statistic skip for now
 		case state == inHeader && strings.HasPrefix(line, "index "):
 			// commit information
-			currentDiff = append(currentDiff, line)
+			currentDiff.Header = append(currentDiff.Header, line)
+
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				return nil, errors.Errorf("incorrect index line: %s", line)
+			}
+
+			blobs := fields[1]
+			if i := strings.Index(blobs, ".."); i >= 0 {
+				currentDiff.OldIndex = blobs[:i]
+				currentDiff.NewIndex = blobs[i+2:]
+			}
 		case state == inHeader && strings.HasPrefix(line, "--- "):
 			// file from
-			currentDiff = append(currentDiff, line)
+			currentDiff.OldName = trimDiffPath(line[4:])
 		case state == inHeader && strings.HasPrefix(line, "+++ "):
 			// file to
-			currentDiff = append(currentDiff, line)
+			currentDiff.NewName = trimDiffPath(line[4:])
+		case (state == inHeader || state == inHunk) && strings.HasPrefix(line, "-- "):
+			// footer
+			state = inFooter
+		case state == inHeader && !strings.HasPrefix(line, "@@ "):
+			// other extended header lines
+			currentDiff.Header = append(currentDiff.Header, line)
 		case (state == inHeader || state == inHunk) && strings.HasPrefix(line, "@@ "):
 			// start new chunk
 			state = inHunk
-			currentDiff = append(currentDiff, line)
-		case state == inHunk && strings.HasPrefix(line, "-- "):
-			// footer
-			state = inFooter
+
+			h, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			currentHunk = h
+			currentDiff.Hunks = append(currentDiff.Hunks, h)
+		case state == inHunk && strings.HasPrefix(line, `\`):
+			// "\ No newline at end of file" marker of the previous line
+			currentHunk.Lines = append(currentHunk.Lines, line)
 		case state == inHunk && (len(line) < 1 || (line[0] != ' ' && line[0] != '+' && line[0] != '-')):
 			return nil, errors.Errorf("incorrect line in hunk: %s", line)
 		case state == inHunk:
-			currentDiff = append(currentDiff, line)
+			currentHunk.Lines = append(currentHunk.Lines, line)
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 
-	if len(currentDiff) > 0 {
+	if currentDiff != nil {
 		diffs = append(diffs, currentDiff)
 	}
 
-	result := make([]string, len(diffs))
-	for i, diff := range diffs {
-		result[i] = strings.Join(diff, "\n")
-	}
-
-	return result, nil
+	return diffs, nil
 }
@@ -0,0 +1,143 @@
+package bpi
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDiff = `---
+ foo.go | 3 ++-
+ 1 file changed, 2 insertions(+), 1 deletion(-)
+
+diff --git a/foo.go b/foo.go
+index e92385f..35f913c 100644
+--- a/foo.go
++++ b/foo.go
+@@ -1,3 +1,4 @@ package foo
+ package foo
+ // bar calls baz
+-func bar() {}
++func bar() { baz() }
++func baz() {}
+diff --git a/qux.c b/qux.c
+new file mode 100644
+index 0000000..3d32680
+--- /dev/null
++++ b/qux.c
+@@ -0,0 +1 @@
++int qux;
+\ No newline at end of file
+`
+
+func TestParseDiff(t *testing.T) {
+	diffs, err := ParseDiff(testDiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %d", len(diffs))
+	}
+
+	foo := diffs[0]
+	if foo.Name() != "foo.go" || foo.OldIndex != "e92385f" || foo.NewIndex != "35f913c" {
+		t.Errorf("unexpected diff of %s %s..%s", foo.Name(), foo.OldIndex, foo.NewIndex)
+	}
+	if len(foo.Hunks) != 1 {
+		t.Fatalf("expected 1 hunk, got %d", len(foo.Hunks))
+	}
+	h := foo.Hunks[0]
+	if h.OldStart != 1 || h.OldLines != 3 || h.NewStart != 1 || h.NewLines != 4 || h.Section != "package foo" {
+		t.Errorf("unexpected hunk %s", h.Header())
+	}
+	if added, deleted := foo.Stat(); added != 2 || deleted != 1 {
+		t.Errorf("expected 2 added and 1 deleted lines, got %d and %d", added, deleted)
+	}
+
+	qux := diffs[1]
+	if qux.OldName != "/dev/null" || qux.Name() != "qux.c" {
+		t.Errorf("unexpected names of the new file %s %s", qux.OldName, qux.NewName)
+	}
+	expected := []string{"+int qux;", `\ No newline at end of file`}
+	if !reflect.DeepEqual(qux.Hunks[0].Lines, expected) {
+		t.Errorf("expected %q, got %q", expected, qux.Hunks[0].Lines)
+	}
+}
+
+func TestParseDiffErrors(t *testing.T) {
+	tests := map[string]string{
+		"index line":  "diff --git a/foo b/foo\nindex \n",
+		"hunk header": "diff --git a/foo b/foo\n--- a/foo\n+++ b/foo\n@@ -a +1 @@\n",
+		"hunk line":   "diff --git a/foo b/foo\n--- a/foo\n+++ b/foo\n@@ -1 +1 @@\n*foo\n",
+	}
+
+	for name, input := range tests {
+		if _, err := ParseDiff(input); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		pre   string
+		post  string
+		fails bool
+	}{
+		{
+			name: "shifted hunk",
+			diff: "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			pre:  "x\na\nb\n",
+			post: "x\na\nc\n",
+		},
+		{
+			name: "no newline in post-image",
+			diff: "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+c\n\\ No newline at end of file\n",
+			pre:  "a\nb\n",
+			post: "a\nc",
+		},
+		{
+			name: "no newline in pre-image",
+			diff: "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n",
+			pre:  "a\nb",
+			post: "a\nc\n",
+		},
+		{
+			name: "no newline after the last hunk",
+			diff: "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+c\n",
+			pre:  "a\nb",
+			post: "c\nb",
+		},
+		{
+			name:  "missing lines",
+			diff:  "diff --git a/f b/f\n--- a/f\n+++ b/f\n@@ -1 +1 @@\n-a\n+c\n",
+			pre:   "b\n",
+			fails: true,
+		},
+	}
+
+	for _, test := range tests {
+		diffs, err := ParseDiff(test.diff)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+
+		post, err := diffs[0].Apply([]byte(test.pre))
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: expected error", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if string(post) != test.post {
+			t.Errorf("%s: expected %q, got %q", test.name, test.post, post)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package bpi
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// PGPSignature is a PGP signature of the message, either PGP/MIME or inline
+type PGPSignature struct {
+	// Inline is set for "-----BEGIN PGP SIGNED MESSAGE-----" bodies
+	Inline bool
+	// Partial is set if the body has text after the inline signature which isn't signed
+	Partial bool
+	// KeyID is the id of the signing key in hex or empty if the signature can't be parsed
+	KeyID string
+
+	issuer    uint64
+	signed    []byte
+	signature []byte
+}
+
+// results of PGP signature verification
+const (
+	PGPValid      = "valid"
+	PGPInvalid    = "invalid"
+	PGPUnknownKey = "unknown key"
+)
+
+// PGPVerification is the result of PGP signature verification
+type PGPVerification struct {
+	Status string
+	KeyID  string
+	// Partial is set if only a part of the body is signed
+	Partial bool
+	// Signer and Fingerprint are set if the key is found in the keyring
+	Signer      string
+	Fingerprint string
+}
+
+// parsePGP detects PGP/MIME and inline signatures,
+// returns the signature or nil and the body to show which is the signed part for PGP/MIME,
+// an inline signature must start the body
+func parsePGP(h mail.Header, body []byte) (*PGPSignature, []byte, error) {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err == nil && mediaType == "multipart/signed" && params["protocol"] == "application/pgp-signature" {
+		return parsePGPMIME(body, params["boundary"])
+	}
+
+	// armor in quotes or after other text isn't a signature of the message
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("-----BEGIN PGP SIGNED MESSAGE-----")) {
+		block, rest := clearsign.Decode(body)
+		if block == nil {
+			return nil, body, errors.New("incorrect inline PGP signature")
+		}
+
+		signature, err := ioutil.ReadAll(block.ArmoredSignature.Body)
+		if err != nil {
+			return nil, body, errors.Wrap(err, "incorrect inline PGP signature")
+		}
+
+		// mailing lists append footers after the signature
+		partial := len(bytes.TrimSpace(rest)) != 0
+		sig := &PGPSignature{Inline: true, Partial: partial, signed: block.Bytes, signature: signature}
+		sig.setIssuer()
+
+		return sig, body, nil
+	}
+
+	return nil, body, nil
+}
+
+// parsePGPMIME splits multipart/signed body (RFC 3156) into the signed part and the signature
+func parsePGPMIME(body []byte, boundary string) (*PGPSignature, []byte, error) {
+	parts := splitMultipart(body, boundary)
+	if len(parts) != 2 {
+		return nil, body, errors.Errorf("multipart/signed message has %d parts", len(parts))
+	}
+
+	sigPart, err := mail.ReadMessage(bytes.NewReader(parts[1]))
+	if err != nil {
+		return nil, body, errors.Wrap(err, "incorrect signature part")
+	}
+
+	block, err := armor.Decode(sigPart.Body)
+	if err != nil {
+		return nil, body, errors.Wrap(err, "incorrect signature part")
+	}
+
+	signature, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return nil, body, errors.Wrap(err, "incorrect signature part")
+	}
+
+	// signed data is canonicalized with CRLF line endings
+	signed := bytes.Replace(parts[0], []byte("\r\n"), []byte("\n"), -1)
+	signed = bytes.Replace(signed, []byte("\n"), []byte("\r\n"), -1)
+
+	sig := &PGPSignature{signed: signed, signature: signature}
+	sig.setIssuer()
+
+	return sig, signedPartText(parts[0]), nil
+}
+
+// splitMultipart returns raw parts of multipart body including their headers
+func splitMultipart(body []byte, boundary string) [][]byte {
+	delimiter := "--" + boundary
+
+	var result [][]byte
+	var current []string
+	inPart := false
+	for _, line := range strings.SplitAfter(string(body), "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if trimmed == delimiter || trimmed == delimiter+"--" {
+			if inPart {
+				// the line break before the delimiter belongs to the delimiter
+				part := strings.Join(current, "")
+				part = strings.TrimSuffix(strings.TrimSuffix(part, "\n"), "\r")
+				result = append(result, []byte(part))
+			}
+
+			current = nil
+			inPart = trimmed == delimiter
+			continue
+		}
+
+		if inPart {
+			current = append(current, line)
+		}
+	}
+
+	return result
+}
+
+// signedPartText returns decoded text of the signed part or the part as is if it isn't a plain text
+func signedPartText(part []byte) []byte {
+	m, err := mail.ReadMessage(bytes.NewReader(part))
+	if err != nil {
+		return part
+	}
+
+	mediaType, _, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err == nil && mediaType != "text/plain" {
+		return part
+	}
+
+	var r io.Reader = m.Body
+	if strings.EqualFold(m.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+		r = quotedprintable.NewReader(r)
+	}
+
+	text, err := ioutil.ReadAll(r)
+	if err != nil {
+		return part
+	}
+
+	return text
+}
+
+// setIssuer sets id of the signing key from the signature packet
+func (s *PGPSignature) setIssuer() {
+	p, err := packet.Read(bytes.NewReader(s.signature))
+	if err != nil {
+		return
+	}
+
+	switch sig := p.(type) {
+	case *packet.Signature:
+		if sig.IssuerKeyId == nil {
+			return
+		}
+		s.issuer = *sig.IssuerKeyId
+	case *packet.SignatureV3:
+		s.issuer = sig.IssuerKeyId
+	default:
+		return
+	}
+
+	s.KeyID = fmt.Sprintf("%016X", s.issuer)
+}
+
+// Keyring verifies PGP signatures with public keys from a local keyring file
+type Keyring struct {
+	keys openpgp.EntityList
+}
+
+// NewKeyring reads armored or binary keyring, for example exported by "gpg --export"
+func NewKeyring(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not read keyring")
+	}
+
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "can not parse keyring")
+	}
+
+	return &Keyring{keys: keys}, nil
+}
+
+// Verify checks the signature against keys of the keyring
+func (k *Keyring) Verify(sig *PGPSignature) *PGPVerification {
+	result := &PGPVerification{KeyID: sig.KeyID, Partial: sig.Partial}
+
+	_, err := openpgp.CheckDetachedSignature(k.keys, bytes.NewReader(sig.signed), bytes.NewReader(sig.signature))
+	switch true {
+	case err == pgperrors.ErrUnknownIssuer:
+		result.Status = PGPUnknownKey
+		return result
+	case err != nil:
+		result.Status = PGPInvalid
+	default:
+		result.Status = PGPValid
+	}
+
+	// the signer is shown for invalid signatures too
+	if keys := k.keys.KeysById(sig.issuer); len(keys) > 0 {
+		result.Signer = entityName(keys[0].Entity)
+		result.Fingerprint = fmt.Sprintf("%X", keys[0].Entity.PrimaryKey.Fingerprint)
+	}
+
+	return result
+}
+
+// entityName returns primary identity of the key
+func entityName(e *openpgp.Entity) string {
+	var names []string
+	for name, id := range e.Identities {
+		if id.SelfSignature != nil && id.SelfSignature.IsPrimaryId != nil && *id.SelfSignature.IsPrimaryId {
+			return name
+		}
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+
+	sort.Strings(names)
+	return names[0]
+}
@@ -0,0 +1,60 @@
+package bpi
+
+import (
+	"bytes"
+	"net/mail"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func TestParsePGPInline(t *testing.T) {
+	entity, err := openpgp.NewEntity("Alice", "", "alice@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, entity.PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("Add baz.\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	quoted := "On Mon, Alice wrote:\n> " + string(bytes.Replace(signed.Bytes(), []byte("\n"), []byte("\n> "), -1))
+
+	tests := []struct {
+		name    string
+		body    string
+		signed  bool
+		partial bool
+	}{
+		{name: "whole body", body: "\n" + signed.String() + "\n", signed: true},
+		{name: "text before", body: "Hi,\n\n" + signed.String()},
+		{name: "quoted", body: quoted},
+		{name: "text after", body: signed.String() + "Added by the list.\n", signed: true, partial: true},
+	}
+
+	for _, test := range tests {
+		sig, _, err := parsePGP(mail.Header{}, []byte(test.body))
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if (sig != nil) != test.signed {
+			t.Errorf("%s: expected signature %v, got %v", test.name, test.signed, sig != nil)
+			continue
+		}
+
+		if sig != nil && sig.Partial != test.partial {
+			t.Errorf("%s: expected partial %v, got %v", test.name, test.partial, sig.Partial)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package bpi
+
+// skeletonContext is the number of messages shown in the thread skeleton before and after the message
+const skeletonContext = 5
+
+// Position describes where the message is in its thread,
+// messages which don't exist are nil
+type Position struct {
+	ID     string
+	Root   *MessageHeader
+	Parent *MessageHeader
+	// PrevSibling and NextSibling are replies to the same parent ordered by date
+	PrevSibling *MessageHeader
+	NextSibling *MessageHeader
+	// Prev and Next are neighbours in thread order
+	Prev *MessageHeader
+	Next *MessageHeader
+	// Thread is all messages of the thread in thread order
+	Thread []*ThreadItem
+	// Skeleton is the part of the thread in thread order around the message
+	Skeleton []*ThreadItem
+	// ThreadCount is the number of messages in the thread
+	ThreadCount int
+}
+
+// ThreadItem is a message header with its level in the thread
+type ThreadItem struct {
+	*MessageHeader
+	Level int
+}
+
+// Position implements Store interface, returns position of the message in its thread by Message-ID
+func (s *MemStore) Position(id string) (*Position, error) {
+	item, ok := s.tree[id]
+	if !ok {
+		return nil, &NotFoundError{Kind: "message", ID: id}
+	}
+
+	head, err := s.threadHead(id)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Position{ID: id, Root: s.idIndex[head.ID]}
+
+	if item.Parent != "" {
+		p.Parent = s.idIndex[item.Parent]
+
+		siblings := s.tree[item.Parent].Children
+		for i, sibling := range siblings {
+			if sibling.ID != id {
+				continue
+			}
+
+			if i > 0 {
+				p.PrevSibling = s.idIndex[siblings[i-1].ID]
+			}
+			if i < len(siblings)-1 {
+				p.NextSibling = s.idIndex[siblings[i+1].ID]
+			}
+		}
+	}
+
+	thread := s.threadOrder(head)
+	p.Thread = thread
+	p.ThreadCount = len(thread)
+	for i, t := range thread {
+		if t.ID != id {
+			continue
+		}
+
+		if i > 0 {
+			p.Prev = thread[i-1].MessageHeader
+		}
+		if i < len(thread)-1 {
+			p.Next = thread[i+1].MessageHeader
+		}
+
+		from, to := i-skeletonContext, i+skeletonContext+1
+		if from < 0 {
+			from = 0
+		}
+		if to > len(thread) {
+			to = len(thread)
+		}
+		p.Skeleton = thread[from:to]
+	}
+
+	return p, nil
+}
+
+// threadOrder returns headers of the thread in depth-first order with their levels
+func (s *MemStore) threadOrder(head *treeItem) []*ThreadItem {
+	var result []*ThreadItem
+	var walk func(item *treeItem, level int)
+	walk = func(item *treeItem, level int) {
+		result = append(result, &ThreadItem{MessageHeader: s.idIndex[item.ID], Level: level})
+		for _, child := range item.Children {
+			walk(child, level+1)
+		}
+	}
+	walk(head, 0)
+
+	return result
+}
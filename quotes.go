@@ -0,0 +1,134 @@
+package bpi
+
+import (
+	"strings"
+)
+
+// quoteMaxDepth is the maximum number of ancestors searched for quoted text
+const quoteMaxDepth = 8
+
+// quoteMinLength is the minimal length of a quoted line preferred for matching
+const quoteMinLength = 10
+
+// QuoteSource points to the paragraph of the message the quotes block was taken from
+type QuoteSource struct {
+	ID        string
+	Block     int
+	Paragraph int
+}
+
+// Paragraphs splits the block into paragraphs separated by empty lines,
+// empty lines stay at the end of the previous paragraph
+func (b *BodyBlock) Paragraphs() []string {
+	var result []string
+	var current string
+	blank := false
+	for _, line := range strings.SplitAfter(b.Body, "\n") {
+		if line == "" {
+			continue
+		}
+
+		empty := strings.TrimSpace(line) == ""
+		if blank && !empty {
+			result = append(result, current)
+			current = ""
+		}
+
+		current += line
+		blank = empty
+	}
+
+	if current != "" {
+		result = append(result, current)
+	}
+
+	return result
+}
+
+// linkQuotes sets sources of quotes blocks of the message searching quoted text
+// in ancestors ordered from the parent to the root
+func linkQuotes(m *Message, ancestors []*Message) {
+	for _, b := range m.Body {
+		if b.Type != "quotes" {
+			continue
+		}
+
+		needle := quoteNeedle(b)
+		if needle == "" {
+			continue
+		}
+
+		// quotes of level N are most likely taken from the N-th ancestor
+		var order []*Message
+		if b.Level <= len(ancestors) {
+			order = append(order, ancestors[b.Level-1:]...)
+			order = append(order, ancestors[:b.Level-1]...)
+		} else {
+			order = ancestors
+		}
+
+		for _, a := range order {
+			if src := findParagraph(a, needle); src != nil {
+				b.Source = src
+				break
+			}
+		}
+	}
+}
+
+// quoteNeedle returns the first long enough unquoted line of the block normalized for matching
+func quoteNeedle(b *BodyBlock) string {
+	var result string
+	for _, line := range strings.Split(b.Body, "\n") {
+		line = normalizeSpace(unquote(line, b.Level))
+		if len(line) >= quoteMinLength {
+			return line
+		}
+
+		if result == "" {
+			result = line
+		}
+	}
+
+	return result
+}
+
+// findParagraph returns paragraph of the message own text containing the line or nil
+func findParagraph(m *Message, needle string) *QuoteSource {
+	for i, b := range m.Body {
+		if b.Type == "quotes" {
+			continue
+		}
+
+		for j, p := range b.Paragraphs() {
+			for _, line := range strings.Split(p, "\n") {
+				if normalizeSpace(line) != needle {
+					continue
+				}
+
+				// patches are rendered as a whole
+				if b.Type == "patch" {
+					j = 0
+				}
+
+				return &QuoteSource{ID: m.ID, Block: i, Paragraph: j}
+			}
+		}
+	}
+
+	return nil
+}
+
+// unquote removes level quote marks with following spaces from the line
+func unquote(line string, level int) string {
+	for i := 0; i < level; i++ {
+		line = strings.TrimLeft(line, " ")
+		line = strings.TrimPrefix(line, ">")
+	}
+
+	return line
+}
+
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
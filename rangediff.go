@@ -0,0 +1,136 @@
+package bpi
+
+import (
+	"strings"
+)
+
+// rangeDiffContext is number of context lines in interdiffs
+const rangeDiffContext = 3
+
+// PatchChange is a pair of corresponding patches from two versions of a series
+type PatchChange struct {
+	// Old is nil for a patch added in the new version
+	Old *Message
+	// New is nil for a patch removed in the new version
+	New *Message
+	// Interdiff is a diff between the old and the new patch, empty if they are equal
+	Interdiff string
+}
+
+// Status returns git range-diff like status of the change:
+// "=" for equal patches, "!" for changed, "<" for removed and ">" for added
+func (c *PatchChange) Status() string {
+	switch true {
+	case c.Old == nil:
+		return ">"
+	case c.New == nil:
+		return "<"
+	case c.Interdiff == "":
+		return "="
+	default:
+		return "!"
+	}
+}
+
+// RangeDiff compares patches of two versions of a series, missing patches must be nil.
+// Patches are matched by title and then by number.
+func RangeDiff(old, new []*Message) ([]*PatchChange, error) {
+	matched := make(map[*Message]bool)
+	pairs := make([]*Message, len(new))
+
+	for i, n := range new {
+		if n == nil {
+			continue
+		}
+
+		for _, o := range old {
+			if o != nil && !matched[o] && normalizeTitle(patchTitle(o)) == normalizeTitle(patchTitle(n)) {
+				pairs[i] = o
+				matched[o] = true
+				break
+			}
+		}
+	}
+
+	for i, n := range new {
+		if n == nil || pairs[i] != nil || i >= len(old) || old[i] == nil || matched[old[i]] {
+			continue
+		}
+
+		pairs[i] = old[i]
+		matched[old[i]] = true
+	}
+
+	var result []*PatchChange
+	for i, n := range new {
+		if n == nil {
+			continue
+		}
+
+		c := &PatchChange{Old: pairs[i], New: n}
+		if c.Old != nil {
+			oldLines, err := patchLines(c.Old)
+			if err != nil {
+				return nil, err
+			}
+
+			newLines, err := patchLines(c.New)
+			if err != nil {
+				return nil, err
+			}
+
+			c.Interdiff = UnifiedDiff(oldLines, newLines, rangeDiffContext)
+		}
+
+		result = append(result, c)
+	}
+
+	for _, o := range old {
+		if o != nil && !matched[o] {
+			result = append(result, &PatchChange{Old: o})
+		}
+	}
+
+	return result, nil
+}
+
+func patchTitle(m *Message) string {
+	if m.Patch != nil {
+		return m.Patch.Title
+	}
+
+	return m.Title
+}
+
+// patchLines returns normalized representation of the patch for comparison:
+// title, commit message and diffs without line numbers like git range-diff does
+func patchLines(m *Message) ([]string, error) {
+	lines := []string{patchTitle(m), ""}
+
+	var inPatch bool
+	for _, b := range m.Body {
+		switch b.Type {
+		case "patch":
+			inPatch = true
+
+			diffs, err := ParseDiff(b.Body)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, d := range diffs {
+				lines = append(lines, "## "+d.Name()+" ##")
+				for _, h := range d.Hunks {
+					lines = append(lines, strings.TrimSpace("@@ "+h.Section))
+					lines = append(lines, h.Lines...)
+				}
+			}
+		case "":
+			if !inPatch {
+				lines = append(lines, strings.Split(strings.TrimRight(b.Body, "\n"), "\n")...)
+			}
+		}
+	}
+
+	return lines, nil
+}
@@ -0,0 +1,68 @@
+package bpi
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// resolveMinPrefix is the minimal length of a truncated Message-ID to look up by prefix
+const resolveMinPrefix = 6
+
+// Resolve implements Store interface, returns headers of messages a truncated or mangled Message-ID
+// may refer to: the exact match after cleaning the ID up, a case-insensitive match or messages
+// with Message-ID starting with it
+func (s *MemStore) Resolve(id string) ([]*MessageHeader, error) {
+	if m, ok := s.idIndex[id]; ok {
+		return []*MessageHeader{m}, nil
+	}
+
+	id = CleanMessageID(id)
+	if m, ok := s.idIndex[id]; ok {
+		return []*MessageHeader{m}, nil
+	}
+
+	if id == "" {
+		return nil, nil
+	}
+
+	lower := strings.ToLower(id)
+	var exact, prefix []*MessageHeader
+	for _, m := range s.idIndex {
+		mid := strings.ToLower(m.ID)
+		switch true {
+		case mid == lower:
+			exact = append(exact, m)
+		case len(lower) >= resolveMinPrefix && strings.HasPrefix(mid, lower):
+			prefix = append(prefix, m)
+		}
+	}
+
+	result := exact
+	if len(result) == 0 {
+		result = prefix
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date.After(result[j].Date)
+	})
+
+	if len(result) > searchLimit {
+		result = result[:searchLimit]
+	}
+
+	return result, nil
+}
+
+// CleanMessageID removes URL escaping, angle brackets and trailing punctuation
+// which are often left around pasted Message-IDs
+func CleanMessageID(id string) string {
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+
+	id = strings.TrimSpace(id)
+	id = strings.TrimPrefix(id, "<")
+	id = strings.TrimRight(id, `>.,;:!?)]}'"`)
+
+	return id
+}
@@ -0,0 +1,347 @@
+package bpi
+
+import (
+	"net/mail"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PatchInfo contains information from "[PATCH v3 2/7]"-like subject prefix
+type PatchInfo struct {
+	// Tags contains other words from the prefix like "RFC" or "net-next"
+	Tags    []string
+	Version int
+	// Number is 0 for a cover letter
+	Number int
+	Total  int
+	// Title is the subject without the prefix
+	Title string
+}
+
+// patchMaxTotal limits the number of patches in a series
+const patchMaxTotal = 999
+
+var (
+	patchVersionRe = regexp.MustCompile(`^[vV](\d+)$`)
+	patchNumberRe  = regexp.MustCompile(`^(\d+)/(\d+)$`)
+)
+
+// ParsePatchSubject parses subject of a message,
+// returns nil if the subject doesn't belong to a patch or a cover letter
+func ParsePatchSubject(subject string) *PatchInfo {
+	s := strings.TrimSpace(subject)
+
+	var words []string
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			break
+		}
+
+		words = append(words, strings.Fields(s[1:end])...)
+		s = strings.TrimSpace(s[end+1:])
+	}
+
+	info := &PatchInfo{Version: 1, Number: 1, Total: 1, Title: s}
+
+	var isPatch bool
+	for _, w := range words {
+		upper := strings.ToUpper(w)
+		switch true {
+		case upper == "PATCH":
+			isPatch = true
+		case strings.HasPrefix(upper, "PATCH") && patchVersionRe.MatchString(w[5:]):
+			// "PATCHv2" form
+			isPatch = true
+			info.Version, _ = strconv.Atoi(w[6:])
+		case patchVersionRe.MatchString(w):
+			info.Version, _ = strconv.Atoi(w[1:])
+		case patchNumberRe.MatchString(w):
+			m := patchNumberRe.FindStringSubmatch(w)
+			info.Number, _ = strconv.Atoi(m[1])
+			info.Total, _ = strconv.Atoi(m[2])
+		default:
+			info.Tags = append(info.Tags, w)
+		}
+	}
+
+	if !isPatch || info.Number > info.Total || info.Total == 0 || info.Total > patchMaxTotal {
+		return nil
+	}
+
+	return info
+}
+
+// Series represents a patch series: optional cover letter and numbered patches
+type Series struct {
+	// ID is Message-ID of the cover letter or of the first received patch
+	ID      string
+	Title   string
+	Author  *mail.Address
+	Date    time.Time
+	Version int
+	Total   int
+	Cover   *MessageHeader
+	// Patches are ordered by number, missing patches are nil
+	Patches []*MessageHeader
+	// Versions contains all known versions of the series including this one ordered by version
+	Versions []*Series
+}
+
+// Previous returns the version posted before this one or nil
+func (s *Series) Previous() *Series {
+	for i, v := range s.Versions {
+		if v == s && i > 0 {
+			return s.Versions[i-1]
+		}
+	}
+
+	return nil
+}
+
+// FindVersion returns series with the version number from the versions of this series or nil
+func (s *Series) FindVersion(version int) *Series {
+	for _, v := range s.Versions {
+		if v.Version == version {
+			return v
+		}
+	}
+
+	return nil
+}
+
+// Received returns number of received patches
+func (s *Series) Received() int {
+	var n int
+	for _, p := range s.Patches {
+		if p != nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Complete returns true if all patches of the series are received
+func (s *Series) Complete() bool {
+	return s.Received() == s.Total
+}
+
+// AttestedBy returns identity of the developer who attested all received patches of a series,
+// missing patches are nil, returns empty string if some patches aren't attested as a whole or attested by different developers
+func AttestedBy(patches []*Message) string {
+	var identity string
+	for _, p := range patches {
+		if p == nil {
+			continue
+		}
+
+		if p.Attestation == nil || p.Attestation.Status != AttestationPass || p.Attestation.Partial {
+			return ""
+		}
+
+		if identity != "" && !strings.EqualFold(identity, p.Attestation.Identity) {
+			return ""
+		}
+		identity = p.Attestation.Identity
+	}
+
+	return identity
+}
+
+// Members returns the cover letter (if any) and all received patches
+func (s *Series) Members() []*MessageHeader {
+	var result []*MessageHeader
+	if s.Cover != nil {
+		result = append(result, s.Cover)
+	}
+	for _, p := range s.Patches {
+		if p != nil {
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+func (s *Series) add(m *MessageHeader) bool {
+	if m.Patch.Number == 0 {
+		if s.Cover != nil {
+			return false
+		}
+
+		// cover letter defines the series
+		s.Cover = m
+		s.ID = m.ID
+		s.Title = m.Patch.Title
+		s.Date = m.Date
+
+		return true
+	}
+
+	if s.Patches[m.Patch.Number-1] != nil {
+		return false
+	}
+
+	s.Patches[m.Patch.Number-1] = m
+
+	return true
+}
+
+// seriesWindow is the maximum time between messages of one series
+// when they can't be grouped by threading
+const seriesWindow = time.Hour
+
+// groupSeries groups patches and cover letters into series,
+// returns map from Message-ID of each member to its series
+func groupSeries(idIndex map[string]*MessageHeader) map[string]*Series {
+	var patches []*MessageHeader
+	for _, m := range idIndex {
+		if m.Patch != nil {
+			patches = append(patches, m)
+		}
+	}
+	sort.Slice(patches, func(i, j int) bool {
+		return patches[i].Date.Before(patches[j].Date)
+	})
+
+	result := make(map[string]*Series)
+	// the latest series for author, version and total
+	// used for patches sent with broken threading
+	latest := make(map[string]*Series)
+
+	for _, m := range patches {
+		key := strings.ToLower(m.Author.Address) + " " +
+			strconv.Itoa(m.Patch.Version) + " " + strconv.Itoa(m.Patch.Total)
+
+		s := result[m.ReplyTo]
+		if s == nil || s.Version != m.Patch.Version || s.Total != m.Patch.Total || !s.add(m) {
+			s = latest[key]
+			if s == nil || m.Date.Sub(s.Date) > seriesWindow || !s.add(m) {
+				s = &Series{
+					ID:      m.ID,
+					Title:   m.Patch.Title,
+					Author:  m.Author,
+					Date:    m.Date,
+					Version: m.Patch.Version,
+					Total:   m.Patch.Total,
+					Patches: make([]*MessageHeader, m.Patch.Total),
+				}
+				s.add(m)
+			}
+		}
+
+		latest[key] = s
+		result[m.ID] = s
+	}
+
+	return result
+}
+
+// linkVersions finds successive versions of the same series
+// by cover letters sent in reply to the previous version and,
+// as a fallback, by author and title of the cover letter or of the first patch;
+// series with the same version are never linked together
+func linkVersions(series map[string]*Series) {
+	var list []*Series
+	seen := make(map[*Series]bool)
+	for _, s := range series {
+		if !seen[s] {
+			seen[s] = true
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Date.Before(list[j].Date)
+	})
+
+	// union-find over distinct series with the versions of each family
+	parent := make(map[*Series]*Series)
+	versions := make(map[*Series]map[int]bool)
+	for _, s := range list {
+		parent[s] = s
+		versions[s] = map[int]bool{s.Version: true}
+	}
+
+	var find func(s *Series) *Series
+	find = func(s *Series) *Series {
+		p := parent[s]
+		if p == s {
+			return s
+		}
+
+		root := find(p)
+		parent[s] = root
+		return root
+	}
+	union := func(a, b *Series) {
+		a, b = find(a), find(b)
+		if a == b {
+			return
+		}
+
+		for v := range versions[a] {
+			if versions[b][v] {
+				return
+			}
+		}
+
+		parent[a] = b
+		for v := range versions[a] {
+			versions[b][v] = true
+		}
+		delete(versions, a)
+	}
+
+	for _, s := range list {
+		if s.Cover == nil || s.Cover.ReplyTo == "" {
+			continue
+		}
+
+		if other, ok := series[s.Cover.ReplyTo]; ok {
+			union(s, other)
+		}
+	}
+
+	byKey := make(map[string][]*Series)
+	for _, s := range list {
+		author := strings.ToLower(s.Author.Address)
+		var keys []string
+		if s.Cover != nil {
+			keys = append(keys, author+" "+normalizeTitle(s.Cover.Patch.Title))
+		}
+		if s.Patches[0] != nil {
+			keys = append(keys, author+" "+normalizeTitle(s.Patches[0].Patch.Title))
+		}
+
+		for _, key := range keys {
+			for _, other := range byKey[key] {
+				union(s, other)
+			}
+			byKey[key] = append(byKey[key], s)
+		}
+	}
+
+	families := make(map[*Series][]*Series)
+	for _, s := range list {
+		root := find(s)
+		families[root] = append(families[root], s)
+	}
+
+	for _, family := range families {
+		sort.Slice(family, func(i, j int) bool {
+			return family[i].Version < family[j].Version
+		})
+
+		for _, s := range family {
+			s.Versions = family
+		}
+	}
+}
+
+func normalizeTitle(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
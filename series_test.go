@@ -0,0 +1,141 @@
+package bpi
+
+import (
+	"net/mail"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePatchSubject(t *testing.T) {
+	tests := []struct {
+		subject string
+		info    *PatchInfo
+	}{
+		{"[PATCH] foo: add baz", &PatchInfo{Version: 1, Number: 1, Total: 1, Title: "foo: add baz"}},
+		{"[PATCH v2 3/5] foo: add baz", &PatchInfo{Version: 2, Number: 3, Total: 5, Title: "foo: add baz"}},
+		{"[PATCHv3 0/2] foo: improve bar", &PatchInfo{Version: 3, Number: 0, Total: 2, Title: "foo: improve bar"}},
+		{"[RFC PATCH net-next V4 1/1] foo", &PatchInfo{Tags: []string{"RFC", "net-next"}, Version: 4, Number: 1, Total: 1, Title: "foo"}},
+		{"[RFC] [PATCH 2/2] foo", &PatchInfo{Tags: []string{"RFC"}, Version: 1, Number: 2, Total: 2, Title: "foo"}},
+		{"  [patch]   foo  ", &PatchInfo{Version: 1, Number: 1, Total: 1, Title: "foo"}},
+		{"[PATCH 3/2] foo", nil},
+		{"[PATCH 1/0] foo", nil},
+		{"[PATCH 1/1000] foo", nil},
+		{"[RFC] foo", nil},
+		{"Re: [PATCH] foo", nil},
+		{"general question", nil},
+		{"[PATCH foo", nil},
+	}
+
+	for _, test := range tests {
+		info := ParsePatchSubject(test.subject)
+		if !reflect.DeepEqual(info, test.info) {
+			t.Errorf("%q: expected %+v, got %+v", test.subject, test.info, info)
+		}
+	}
+}
+
+// testHeader returns header of a message with the subject sent by the author n minutes after the epoch
+func testHeader(id, replyTo, author, subject string, n int) *MessageHeader {
+	return &MessageHeader{
+		ID:      id,
+		ReplyTo: replyTo,
+		Author:  &mail.Address{Address: author},
+		Date:    time.Unix(0, 0).Add(time.Duration(n) * time.Minute),
+		Title:   subject,
+		Patch:   ParsePatchSubject(subject),
+	}
+}
+
+func testIndex(headers ...*MessageHeader) map[string]*MessageHeader {
+	index := make(map[string]*MessageHeader)
+	for _, h := range headers {
+		index[h.ID] = h
+	}
+
+	return index
+}
+
+func TestGroupSeries(t *testing.T) {
+	series := groupSeries(testIndex(
+		testHeader("cover", "", "alice@example.com", "[PATCH 0/3] foo", 0),
+		testHeader("p1", "cover", "alice@example.com", "[PATCH 1/3] foo: one", 1),
+		testHeader("p3", "cover", "alice@example.com", "[PATCH 3/3] foo: three", 2),
+		// broken threading, grouped by author, version and total
+		testHeader("q1", "", "bob@example.com", "[PATCH 1/2] bar: one", 3),
+		testHeader("q2", "", "bob@example.com", "[PATCH 2/2] bar: two", 4),
+		// too late to belong to the series of bob
+		testHeader("r1", "", "bob@example.com", "[PATCH 1/2] baz: one", 200),
+		testHeader("question", "", "carol@example.com", "question", 5),
+	))
+
+	cover := series["cover"]
+	if cover == nil || series["p1"] != cover || series["p3"] != cover {
+		t.Fatalf("cover letter and patches are in different series")
+	}
+	if cover.ID != "cover" || cover.Title != "foo" || cover.Total != 3 {
+		t.Errorf("unexpected series %+v", cover)
+	}
+	if cover.Received() != 2 || cover.Complete() || cover.Patches[1] != nil {
+		t.Errorf("expected 2 of 3 patches received")
+	}
+
+	bob := series["q1"]
+	if bob == nil || series["q2"] != bob || !bob.Complete() || bob.Cover != nil {
+		t.Errorf("patches without cover letter aren't grouped")
+	}
+	if series["r1"] == bob {
+		t.Errorf("patches sent hours later are grouped together")
+	}
+
+	if _, ok := series["question"]; ok {
+		t.Errorf("regular message is in a series")
+	}
+}
+
+func TestLinkVersions(t *testing.T) {
+	series := groupSeries(testIndex(
+		testHeader("v1", "", "alice@example.com", "[PATCH 0/1] foo: improve bar", 0),
+		testHeader("v1p1", "v1", "alice@example.com", "[PATCH 1/1] foo: add baz", 1),
+		// the cover letter replies to the previous version with a new title
+		testHeader("v2", "v1", "alice@example.com", "[PATCH v2 0/1] foo: rework bar", 100),
+		testHeader("v2p1", "v2", "alice@example.com", "[PATCH v2 1/1] foo: add baz", 101),
+		// no threading, linked by author and title
+		testHeader("v3p1", "", "alice@example.com", "[PATCH v3] foo: add  Baz", 200),
+		// the same version sent again isn't another version
+		testHeader("resend", "", "alice@example.com", "[PATCH v3] foo: add baz", 300),
+		// the same title by another author
+		testHeader("bob", "", "bob@example.com", "[PATCH v2] foo: add baz", 400),
+	))
+	linkVersions(series)
+
+	versions := func(id string) []string {
+		var ids []string
+		for _, s := range series[id].Versions {
+			ids = append(ids, s.ID)
+		}
+
+		return ids
+	}
+
+	expected := []string{"v1", "v2", "v3p1"}
+	for _, id := range expected {
+		if got := versions(id); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected versions %v, got %v", id, expected, got)
+		}
+	}
+
+	if series["v2"].Previous() != series["v1"] || series["v1"].Previous() != nil {
+		t.Errorf("unexpected previous versions")
+	}
+	if series["v3p1"].FindVersion(2) != series["v2"] || series["v3p1"].FindVersion(4) != nil {
+		t.Errorf("unexpected versions by number")
+	}
+
+	if got := versions("resend"); !reflect.DeepEqual(got, []string{"resend"}) {
+		t.Errorf("resend: expected no other versions, got %v", got)
+	}
+	if got := versions("bob"); !reflect.DeepEqual(got, []string{"bob"}) {
+		t.Errorf("bob: expected no other versions, got %v", got)
+	}
+}
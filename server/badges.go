@@ -0,0 +1,14 @@
+package server
+
+const badgesTpl = `
+{{define "badges"}}{{with .SignOff}}{{if .Passed}}<span class="pass" title="Signed-off-by matches the author and the submitter">[DCO: pass]</span>{{else}}<span class="fail" title="{{ .Reason }}">[DCO: fail, {{ .Reason }}]</span>{{end}}{{end}}{{end}}
+
+{{define "applyBadge"}}{{if .Applies}}<span class="pass">[applies cleanly to {{ .Branch }}]</span>{{else if .Conflicts}}<span class="fail">[conflicts with {{ .Branch }} in {{range $i, $f := .Conflicts}}{{if $i}}, {{end}}{{ $f }}{{end}}]</span>{{else}}<span class="fail">[doesn't apply to {{ .Branch }}]</span>{{end}}{{if not .BaseFound}} (base blobs not found in the repository){{else if .AppliesToBase}} (applies to its base){{else}} <span class="fail">(doesn't apply to its base)</span>{{end}}{{end}}
+
+{{define "mergedBadge"}}<span class="pass" title="{{ .Title }}">[merged as {{ printf "%.12s" .SHA }} in {{ .Branch }}]</span>{{end}}
+
+{{define "pgpBadge"}}{{if eq .Status "valid"}}<span class="pass" title="{{ .Fingerprint }}">[PGP: valid signature by {{ .Signer }}, key {{ .KeyID }}]</span>{{else if eq .Status "invalid"}}<span class="fail" title="{{ .Fingerprint }}">[PGP: invalid signature{{if .Signer}} by {{ .Signer }}{{end}}, key {{ .KeyID }}]</span>{{else}}<span class="unknown">[PGP: unknown key {{ .KeyID }}]</span>{{end}}{{if .Partial}} <span class="unknown">(text after the signature isn't signed)</span>{{end}}{{end}}
+
+{{define "dkimBadge"}}{{if eq .Status "pass"}}{{if .Aligned}}<span class="pass">[DKIM: pass, d={{ .Domain }}]</span>{{else}}<span class="unknown" title="signing domain doesn't match From">[DKIM: pass for other domain, d={{ .Domain }}]</span>{{end}}{{else if eq .Status "fail"}}<span class="fail">[DKIM: fail, d={{ .Domain }}, {{ .Reason }}]</span>{{else}}<span class="unknown">[DKIM: no key for {{ .Selector }}._domainkey.{{ .Domain }}]</span>{{end}}{{if and .Partial (ne .Status "fail")}} <span class="unknown">(text at the end of the body isn't signed)</span>{{end}}{{end}}
+
+{{define "attestationBadge"}}{{if eq .Status "pass"}}<span class="pass">[attested by {{ .Identity }}]</span>{{else if eq .Status "fail"}}<span class="fail">[attestation by {{ .Identity }} failed, {{ .Reason }}]</span>{{else}}<span class="unknown">[attested by {{ .Identity }}, key not in keyring]</span>{{end}}{{if and .Partial (ne .Status "fail")}} <span class="unknown">(text at the end of the patch isn't attested)</span>{{end}}{{end}}`
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/smacker/better-public-inbox"
+)
+
+// hunkComments returns comments of the hunk by index of the commented line
+func hunkComments(m *bpi.Message, file, hunk int) map[int][]*bpi.LineComment {
+	result := make(map[int][]*bpi.LineComment)
+	for _, c := range m.Comments {
+		if c.File == file && c.Hunk == hunk {
+			result[c.Line] = append(result[c.Line], c)
+		}
+	}
+
+	return result
+}
+
+// renderComments renders review comments placed under a diff line
+func renderComments(opts *renderOptions, comments []*bpi.LineComment) string {
+	var b strings.Builder
+	for _, c := range comments {
+		name := c.Author.Name
+		if name == "" {
+			name = c.Author.Address
+		}
+
+		link := opts.Root + url.PathEscape(c.ID) + "/T/#m" + idshort(c.ID)
+		b.WriteString(`<div class="comment"><a href="` + template.HTMLEscapeString(link) + `">` +
+			template.HTMLEscapeString(name) + `</a> ` + c.Date.Format("2006-01-02 15:04") +
+			`<pre>` + template.HTMLEscapeString(c.Text) + `</pre></div>`)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/smacker/better-public-inbox"
+)
+
+// commitHandler redirects to the thread of the patch merged as the commit
+func (s *HTTPServer) commitHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.merges == nil {
+		return &bpi.NotFoundError{Kind: "commit", ID: chi.URLParam(r, "sha")}
+	}
+
+	id, err := s.merges.Message(chi.URLParam(r, "sha"))
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, relativeRoot(r)+url.PathEscape(id)+"/T/#m"+idshort(id), http.StatusFound)
+	return nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/smacker/better-public-inbox"
+)
+
+// expandStep is number of lines loaded by one click on expand button
+const expandStep = 10
+
+// renderDiffs renders diffs of the message hunk by hunk
+// adding buttons to expand context when it's enabled,
+// first is index of the first diff among diffs of all patch blocks of the message
+func renderDiffs(opts *renderOptions, m *bpi.Message, diffs []*bpi.FileDiff, first int) string {
+	var result []string
+	for i, d := range diffs {
+		i += first
+		expand := opts.Expand && d.OldIndex != "" && strings.Trim(d.OldIndex, "0") != ""
+
+		result = append(result, formatDiffOrText(strings.Join(d.HeaderLines(), "\n")))
+		lexer := fileLexer(d.Name())
+
+		ctxURL := opts.Root + url.PathEscape(m.ID) + "/s/ctx?b=" + url.QueryEscape(d.Name())
+		if opts.Split {
+			ctxURL += "&split=1"
+		}
+
+		// first pre-image line after the previous hunk
+		// and the difference between new and old line numbers after it
+		next, delta := 1, 0
+		for j, h := range d.Hunks {
+			target := fmt.Sprintf("c%.8s-%d-%d", idshort(m.ID), i, j)
+
+			if expand && h.OldStart > next {
+				result = append(result, expandButton(ctxURL, target, true, next, h.OldStart-1, h.NewStart-h.OldStart))
+			}
+			result = append(result, `<div id="`+target+`"></div>`)
+			comments := hunkComments(m, i, j)
+			if opts.Split {
+				result = append(result, renderSplitHunk(opts, h, comments))
+			} else {
+				// hunk is split after commented lines to place comments under them
+				header, start := h.Header(), 0
+				for k := range h.Lines {
+					if len(comments[k]) == 0 {
+						continue
+					}
+
+					result = append(result, formatHunk(lexer, header, h.Lines[start:k+1]))
+					result = append(result, renderComments(opts, comments[k]))
+					header, start = "", k+1
+				}
+				if start < len(h.Lines) {
+					result = append(result, formatHunk(lexer, header, h.Lines[start:]))
+				}
+			}
+
+			next = h.OldStart + h.OldLines
+			delta = h.NewStart + h.NewLines - next
+		}
+
+		if expand && len(d.Hunks) > 0 {
+			target := fmt.Sprintf("c%.8s-%d-end", idshort(m.ID), i)
+			result = append(result, `<div id="`+target+`"></div>`)
+			result = append(result, expandButton(ctxURL, target, false, next, 0, delta))
+		}
+	}
+
+	return `<div class="diff">` + strings.Join(result, "") + `</div>`
+}
+
+// expandButton renders button which loads pre-image lines into the target element,
+// lines above a hunk are loaded bottom-up until min line
+func expandButton(ctxURL, target string, up bool, min, max, delta int) string {
+	from, to := max-expandStep+1, max
+	if from < min {
+		from = min
+	}
+	label := "&uarr; expand"
+	if !up {
+		from, to = min, min+expandStep-1
+		label = "&darr; expand"
+	}
+
+	return fmt.Sprintf(`<a href="#" class="expand" data-url="%s" data-target="%s" data-up="%t" data-min="%d" data-from="%d" data-to="%d" data-step="%d" onclick="return expandContext(this)">%s</a>`,
+		template.HTMLEscapeString(ctxURL+"&delta="+strconv.Itoa(delta)), target, up, min, from, to, expandStep, label)
+}
+
+func formatDiffOrText(diff string) string {
+	html, err := formatDiff(diff)
+	if err != nil {
+		return "<pre>" + template.HTMLEscapeString(diff) + "</pre>"
+	}
+
+	return html
+}
+
+// contextHandler returns pre-image lines of a file changed by the patch
+// rendered as diff context lines
+func (s *HTTPServer) contextHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.solver == nil {
+		return &bpi.NotFoundError{Kind: "context of message", ID: chi.URLParam(r, "id")}
+	}
+
+	id := chi.URLParam(r, "id")
+	query := r.URL.Query()
+	path := query.Get("b")
+
+	from, err := strconv.Atoi(query.Get("from"))
+	if err != nil {
+		return badRequestError("incorrect from line number")
+	}
+
+	to, err := strconv.Atoi(query.Get("to"))
+	if err != nil {
+		return badRequestError("incorrect to line number")
+	}
+
+	m, err := s.ts.Message(id)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := m.Diffs()
+	if err != nil {
+		return err
+	}
+
+	var diff *bpi.FileDiff
+	for _, d := range diffs {
+		if d.Name() == path {
+			diff = d
+			break
+		}
+	}
+	if diff == nil {
+		return &bpi.NotFoundError{Kind: "changed file", ID: path}
+	}
+
+	content, err := s.solver.PreImage(diff)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if from < 1 {
+		from = 1
+	}
+	if to > len(lines) {
+		to = len(lines)
+	}
+	if from > to || len(content) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if query.Get("split") != "" {
+		delta, _ := strconv.Atoi(query.Get("delta"))
+		_, err = w.Write([]byte(renderSplitContext(lines[from-1:to], from, delta)))
+		return err
+	}
+
+	ctx := make([]string, 0, to-from+1)
+	for _, line := range lines[from-1 : to] {
+		ctx = append(ctx, " "+line)
+	}
+
+	_, err = w.Write([]byte(formatHunk(fileLexer(diff.Name()), "", ctx)))
+	return err
+}
+
+const expandScriptTpl = `
+{{define "expandScript"}}
+<script>
+function expandContext(a) {
+	var up = a.dataset.up === "true", from = +a.dataset.from, to = +a.dataset.to, step = +a.dataset.step;
+	fetch(a.dataset.url + "&from=" + from + "&to=" + to).then(function(r) {
+		return r.text();
+	}).then(function(html) {
+		var target = document.getElementById(a.dataset.target);
+		var div = document.createElement("div");
+		div.innerHTML = html;
+		if (up) {
+			target.insertBefore(div, target.firstChild);
+			a.dataset.to = from - 1;
+			a.dataset.from = Math.max(+a.dataset.min, from - step);
+		} else {
+			target.appendChild(div);
+			a.dataset.from = to + 1;
+			a.dataset.to = to + step;
+		}
+		if (!html || +a.dataset.from > +a.dataset.to) {
+			a.parentNode.removeChild(a);
+		}
+	});
+	return false;
+}
+</script>
+{{end}}`
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/smacker/better-public-inbox"
+)
+
+// notFound shows 404 page with messages whose Message-ID looks like the requested one
+func (s *HTTPServer) notFound(w http.ResponseWriter, r *http.Request, err error) {
+	id := chi.URLParam(r, "id")
+
+	var suggestions []*bpi.MessageHeader
+	if id != "" {
+		var resolveErr error
+		suggestions, resolveErr = s.ts.Resolve(id)
+		// a mangled domain part shouldn't hide messages with the same local part
+		if resolveErr == nil && len(suggestions) == 0 && strings.Contains(id, "@") {
+			suggestions, resolveErr = s.ts.Resolve(id[:strings.IndexByte(id, '@')+1])
+		}
+		if resolveErr != nil {
+			logrus.Warnf("can not resolve messages similar to '%s': %s", id, resolveErr)
+		}
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+
+	err = template.Must(template.Must(baseT.Clone()).Parse(notFoundTpl)).Execute(w, struct {
+		Error       string
+		ID          string
+		Suggestions []*bpi.MessageHeader
+		Root        string
+	}{Error: err.Error(), ID: id, Suggestions: suggestions, Root: relativeRoot(r)})
+	if err != nil {
+		logrus.Errorf("can not render not found page: %s", err)
+	}
+}
+
+// internalError logs the error with the request ID and shows a generic error page
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	reqID := middleware.GetReqID(r.Context())
+	logrus.WithField("request_id", reqID).Errorf("%s %s: %s", r.Method, r.URL, err)
+
+	w.WriteHeader(http.StatusInternalServerError)
+
+	err = template.Must(template.Must(baseT.Clone()).Parse(internalErrorTpl)).Execute(w, struct {
+		RequestID string
+		Root      string
+	}{RequestID: reqID, Root: relativeRoot(r)})
+	if err != nil {
+		logrus.Errorf("can not render error page: %s", err)
+	}
+}
+
+const notFoundTpl = `
+{{define "title"}}not found{{end}}
+{{define "content"}}
+<pre>
+<strong>404 Not Found</strong>
+
+{{ .Error }}
+{{if .Suggestions}}
+Messages with similar Message-ID:
+{{range .Suggestions}}
+<a href="{{ $.Root }}{{ .ID }}/">{{ .Title }}</a>
+  &lt;{{ .ID }}&gt; {{ .Date.UTC.Format "2006-01-02 15:04" }}{{end}}
+{{end}}
+<form action="{{ .Root }}search">Search by subject or Message-ID: <input name="q" value="{{ .ID }}"> <input type="submit" value="search"></form>
+back to <a href="{{ .Root }}">index</a>
+</pre>
+{{end}}`
+
+// badRequestError is returned by handlers when parameters of the request are incorrect
+type badRequestError string
+
+func (e badRequestError) Error() string {
+	return string(e)
+}
+
+func isBadRequest(err error) bool {
+	_, ok := errors.Cause(err).(badRequestError)
+	return ok
+}
+
+// errorPage shows a page with the status and the message for the user
+func errorPage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.WriteHeader(status)
+
+	err := template.Must(template.Must(baseT.Clone()).Parse(errorTpl)).Execute(w, struct {
+		Status  string
+		Message string
+		Root    string
+	}{Status: fmt.Sprintf("%d %s", status, http.StatusText(status)), Message: message, Root: relativeRoot(r)})
+	if err != nil {
+		logrus.Errorf("can not render error page: %s", err)
+	}
+}
+
+const errorTpl = `
+{{define "title"}}error{{end}}
+{{define "content"}}
+<pre>
+<strong>{{ .Status }}</strong>
+
+{{ .Message }}
+
+back to <a href="{{ .Root }}">index</a>
+</pre>
+{{end}}`
+
+const internalErrorTpl = `
+{{define "title"}}error{{end}}
+{{define "content"}}
+<pre>
+<strong>500 Internal Server Error</strong>
+
+Something went wrong while rendering the page.
+{{with .RequestID}}Please mention request ID {{ . }} when reporting the problem.
+{{end}}
+back to <a href="{{ .Root }}">index</a>
+</pre>
+{{end}}`
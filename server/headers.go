@@ -0,0 +1,48 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/smacker/better-public-inbox"
+)
+
+// headersHandler shows all header fields of the message as they were received
+func (s *HTTPServer) headersHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(headersTpl)
+	if err != nil {
+		return err
+	}
+
+	id := chi.URLParam(r, "id")
+
+	m, err := s.ts.Message(id)
+	if err != nil {
+		return err
+	}
+
+	raw, err := s.ts.Raw(m.ID)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, struct {
+		Msg     *bpi.Message
+		Headers []*bpi.HeaderField
+	}{Msg: m, Headers: bpi.RawHeaderFields(raw)})
+}
+
+const headersTpl = `
+{{define "title"}}headers: {{ .Msg.Title }}{{end}}
+{{define "content"}}
+<pre>
+<strong>{{ .Msg.Title }}</strong>
+{{range .Headers}}
+<strong>{{ .Name }}:</strong> {{ .Value }}{{end}}
+</pre>
+<hr>
+<pre>
+back to <a href="../{{ .Msg.ID }}/">message</a> <a href="../{{ .Msg.ID }}/T/#m{{ .Msg.ID | idshort }}">thread</a>
+</pre>
+{{end}}`
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"html"
+	"strings"
+
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// backgrounds of added and deleted lines in highlighted diffs
+const (
+	addedLineStyle   = "display:block;background-color:#eaffea"
+	deletedLineStyle = "display:block;background-color:#ffecec"
+)
+
+// fileLexer returns lexer matched by the file name or nil if the language is unknown
+func fileLexer(name string) chroma.Lexer {
+	lexer := lexers.Match(name)
+	if lexer == nil {
+		return nil
+	}
+
+	return chroma.Coalesce(lexer)
+}
+
+// formatHunk renders hunk header and lines highlighting code with the lexer,
+// falls back to diff highlighting without lexer
+func formatHunk(lexer chroma.Lexer, header string, lines []string) string {
+	if lexer != nil {
+		code, err := highlightDiffLines(lexer, lines)
+		if err == nil {
+			if header == "" {
+				return code
+			}
+
+			return formatDiffOrText(header) + code
+		}
+
+		logrus.Debugf("can not highlight diff with %s lexer: %s", lexer.Config().Name, err)
+	}
+
+	if header != "" {
+		lines = append([]string{header}, lines...)
+	}
+
+	return formatDiffOrText(strings.Join(lines, "\n"))
+}
+
+// highlightDiffLines renders diff lines with ' ', '+' or '-' prefix
+// tokenizing the code of the old and the new side with the lexer of the file language
+func highlightDiffLines(lexer chroma.Lexer, lines []string) (string, error) {
+	var oldSide, newSide []string
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		switch line[0] {
+		case ' ':
+			oldSide = append(oldSide, line[1:])
+			newSide = append(newSide, line[1:])
+		case '-':
+			oldSide = append(oldSide, line[1:])
+		case '+':
+			newSide = append(newSide, line[1:])
+		}
+	}
+
+	oldTokens, err := tokeniseLines(lexer, oldSide)
+	if err != nil {
+		return "", err
+	}
+
+	newTokens, err := tokeniseLines(lexer, newSide)
+	if err != nil {
+		return "", err
+	}
+
+	style := styles.Get("pygments")
+
+	var b strings.Builder
+	b.WriteString(`<pre>`)
+	var oi, ni int
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		var tokens []chroma.Token
+		switch line[0] {
+		case ' ':
+			tokens = newTokens[ni]
+			oi++
+			ni++
+			b.WriteString("<span>")
+		case '-':
+			tokens = oldTokens[oi]
+			oi++
+			b.WriteString(`<span style="` + deletedLineStyle + `">`)
+		case '+':
+			tokens = newTokens[ni]
+			ni++
+			b.WriteString(`<span style="` + addedLineStyle + `">`)
+		default:
+			// "\ No newline at end of file" marker
+			b.WriteString("<span>" + html.EscapeString(line) + "\n</span>")
+			continue
+		}
+
+		b.WriteString(html.EscapeString(line[:1]))
+		for _, t := range tokens {
+			css := chromahtml.StyleEntryToCSS(style.Get(t.Type))
+			if css == "" {
+				b.WriteString(html.EscapeString(t.Value))
+				continue
+			}
+
+			b.WriteString(`<span style="` + css + `">` + html.EscapeString(t.Value) + `</span>`)
+		}
+		b.WriteString("</span>")
+	}
+	b.WriteString(`</pre>`)
+
+	return b.String(), nil
+}
+
+// tokeniseLines tokenizes lines of code and splits tokens back into the lines,
+// every line ends with a newline token
+func tokeniseLines(lexer chroma.Lexer, lines []string) ([][]chroma.Token, error) {
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	iterator, err := lexer.Tokenise(nil, strings.Join(lines, "\n")+"\n")
+	if err != nil {
+		return nil, err
+	}
+
+	result := chroma.SplitTokensIntoLines(iterator.Tokens())
+	if len(result) < len(lines) {
+		return nil, errors.Errorf("lexer %s returned %d lines instead of %d", lexer.Config().Name, len(result), len(lines))
+	}
+
+	return result, nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"html/template"
 	"net/http"
+	"net/mail"
 	"strings"
 
 	"github.com/alecthomas/chroma/formatters/html"
@@ -13,28 +14,78 @@ import (
 	"github.com/alecthomas/chroma/styles"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
 	"github.com/smacker/better-public-inbox"
 )
 
 type HTTPServer struct {
-	ts  bpi.Store
-	mux http.Handler
+	ts      bpi.Store
+	repo    *bpi.GitRepo
+	merges  *bpi.MergeIndex
+	solver  *bpi.Solver
+	keyring *bpi.Keyring
+	address string
+	// lookup checks whether other inboxes of the server have the Message-ID
+	lookup func(id string) bool
+	mux    http.Handler
 }
 
-func NewHTTPServer(ts bpi.Store) *HTTPServer {
+// Option configures HTTPServer
+type Option func(*HTTPServer)
+
+// WithRepository enables features which require local git repository of the project
+func WithRepository(repo *bpi.GitRepo) Option {
+	return func(s *HTTPServer) {
+		s.repo = repo
+	}
+}
+
+// WithKeyring enables verification of PGP signatures of messages against the keyring
+func WithKeyring(keyring *bpi.Keyring) Option {
+	return func(s *HTTPServer) {
+		s.keyring = keyring
+	}
+}
+
+// WithListAddress sets the address of the mailing list added to Cc in reply instructions
+func WithListAddress(address string) Option {
+	return func(s *HTTPServer) {
+		s.address = address
+	}
+}
+
+func NewHTTPServer(ts bpi.Store, opts ...Option) *HTTPServer {
 	r := chi.NewRouter()
 	s := &HTTPServer{
 		ts:  ts,
 		mux: r,
 	}
 
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.repo != nil {
+		s.merges = bpi.NewMergeIndex(s.repo, ts)
+		s.solver = bpi.NewSolver(s.repo, ts)
+	}
+
 	r.Use(middleware.StripSlashes)
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
-	r.Get("/", render(s.indexHandler))
-	r.Get("/{id}", render(s.msgHandler))
-	r.Get("/{id}/T", render(s.threadHandler))
+	r.Get("/", s.render(s.indexHandler))
+	r.Get("/{id}", s.render(s.msgHandler))
+	r.Get("/{id}/T", s.render(s.threadHandler))
+	r.Get("/{id}/headers", s.render(s.headersHandler))
+	r.Get("/{id}/raw", s.render(s.rawHandler))
+	r.Get("/{id}/series", s.render(s.seriesHandler))
+	r.Get("/{id}/series/range-diff", s.render(s.rangeDiffHandler))
+	r.Get("/{id}/s", s.render(s.solverHandler))
+	r.Get("/{id}/s/ctx", s.render(s.contextHandler))
+	r.Get("/commit/{sha}", s.render(s.commitHandler))
+	r.Get("/search", s.render(s.searchHandler))
 	r.Get("/favicon.ico", http.NotFound)
 
 	return s
@@ -44,11 +95,44 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
 }
 
-func render(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+// mergedCommit returns commit that merged the message or nil
+func (s *HTTPServer) mergedCommit(id string) *bpi.Commit {
+	if s.merges == nil {
+		return nil
+	}
+
+	return s.merges.Commit(id)
+}
+
+// verifyPGP returns result of PGP signature verification of the message,
+// nil if the message isn't signed or keyring isn't configured
+func (s *HTTPServer) verifyPGP(m *bpi.Message) *bpi.PGPVerification {
+	if s.keyring == nil || m.PGP == nil {
+		return nil
+	}
+
+	return s.keyring.Verify(m.PGP)
+}
+
+// render wraps the handler redirecting mangled Message-IDs, showing not found page
+// for bpi.NotFoundError and a generic error page for other errors
+func (s *HTTPServer) render(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := handler(w, r); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		err := handler(w, r)
+		switch true {
+		case err == nil:
 			return
+		case bpi.IsNotFound(err):
+			if !s.resolve(w, r, err) {
+				s.notFound(w, r, err)
+			}
+		case isBadRequest(err):
+			errorPage(w, r, http.StatusBadRequest, err.Error())
+		case errors.Cause(err) == bpi.ErrNotReady:
+			w.Header().Set("Retry-After", "10")
+			errorPage(w, r, http.StatusServiceUnavailable, "The page isn't available while the archive is being indexed, please try again later.")
+		default:
+			internalError(w, r, err)
 		}
 	}
 }
@@ -58,6 +142,34 @@ var funcs = template.FuncMap{
 	"htmlDiff":    htmlDiff,
 	"repeat":      strings.Repeat,
 	"renderBlock": renderBlock,
+	"names":       names,
+	"addresses":   addresses,
+}
+
+// names returns display names of the addresses falling back to the address itself
+func names(list []*mail.Address) string {
+	result := make([]string, len(list))
+	for i, addr := range list {
+		result[i] = addr.Name
+		if result[i] == "" {
+			result[i] = addr.Address
+		}
+	}
+
+	return strings.Join(result, ", ")
+}
+
+// addresses formats the addresses as "Name <address>" without encoding of the names
+func addresses(list []*mail.Address) string {
+	result := make([]string, len(list))
+	for i, addr := range list {
+		result[i] = addr.Address
+		if addr.Name != "" {
+			result[i] = addr.Name + " <" + addr.Address + ">"
+		}
+	}
+
+	return strings.Join(result, ", ")
 }
 
 func idshort(id string) string {
@@ -96,29 +208,122 @@ func formatDiff(diff string) (string, error) {
 	return buf.String(), nil
 }
 
-func renderBlock(body, t string) interface{} {
-	switch t {
-	case "quotes":
-		return template.HTML("<pre class='quotes'>" + template.HTMLEscapeString(body) + "</pre>")
-	case "patch":
-		diffs, err := bpi.ParseDiff(body)
-		if err != nil {
-			return body
+// renderOptions configures rendering of message bodies for a request
+type renderOptions struct {
+	// Expand enables buttons which load more context around diff hunks
+	Expand bool
+	// Split renders diffs side-by-side
+	Split bool
+	// Thread is set when all messages of the thread are on the page,
+	// links to quoted messages point to anchors on the same page
+	Thread bool
+	// Root is the relative path from the page to the root of the inbox
+	Root string
+}
+
+// diffViewCookie keeps diff view chosen by "diff" query parameter
+const diffViewCookie = "diff"
+
+func (s *HTTPServer) renderOptions(w http.ResponseWriter, r *http.Request) *renderOptions {
+	view := r.URL.Query().Get("diff")
+	if view == "split" || view == "unified" {
+		http.SetCookie(w, &http.Cookie{
+			Name:   diffViewCookie,
+			Value:  view,
+			Path:   "/",
+			MaxAge: 365 * 24 * 60 * 60,
+		})
+	} else if c, err := r.Cookie(diffViewCookie); err == nil {
+		view = c.Value
+	}
+
+	return &renderOptions{
+		Expand: s.solver != nil,
+		Split:  view == "split",
+		Root:   relativeRoot(r),
+	}
+}
+
+// relativeRoot returns the relative path from the requested page to the root of the inbox
+// which works both for the server mounted at "/" and at "/{inbox}/"
+func relativeRoot(r *http.Request) string {
+	// the path inside of the mounted router without the trailing slash
+	path := chi.RouteContext(r.Context()).RoutePath
+	if path == "" {
+		path = r.URL.Path
+	}
+
+	depth := strings.Count(strings.TrimSuffix(path, "/"), "/") - 1
+	if strings.HasSuffix(r.URL.Path, "/") {
+		depth++
+	}
+
+	if depth <= 0 {
+		return "./"
+	}
+
+	return strings.Repeat("../", depth)
+}
+
+func renderBlock(opts *renderOptions, m *bpi.Message, b *bpi.BodyBlock) interface{} {
+	// n is index of the block, first is index of its first diff among diffs of all patch blocks
+	var n, first int
+	for i := range m.Body {
+		if m.Body[i] == b {
+			n = i
+			break
 		}
 
-		var result []string
-		for _, diff := range diffs {
-			html, err := formatDiff(diff)
-			if err != nil {
-				html = "<pre>" + template.HTMLEscapeString(diff) + "</pre>"
-			}
-			result = append(result, html)
+		if m.Body[i].Type == "patch" {
+			diffs, _ := bpi.ParseDiff(m.Body[i].Body)
+			first += len(diffs)
+		}
+	}
+
+	switch true {
+	case b.Dimmed():
+		return template.HTML(renderDimmed(b))
+	case b.Type == "quotes":
+		return template.HTML(renderQuotes(opts, b))
+	case b.Type == "patch":
+		diffs, err := bpi.ParseDiff(b.Body)
+		if err != nil {
+			return b.Body
 		}
 
-		return template.HTML(strings.Join(result, ""))
+		return template.HTML(`<div id="` + paragraphAnchor(m.ID, n, 0) + `">` + renderDiffs(opts, m, diffs, first) + `</div>`)
 	default:
-		return template.HTML("<pre>" + template.HTMLEscapeString(body) + "</pre>")
+		var result strings.Builder
+		result.WriteString("<pre>")
+		for i, p := range b.Paragraphs() {
+			result.WriteString(`<span id="` + paragraphAnchor(m.ID, n, i) + `">` + template.HTMLEscapeString(p) + `</span>`)
+		}
+		result.WriteString("</pre>")
+
+		return template.HTML(result.String())
+	}
+}
+
+// dimmedLabels are summaries of collapsed signatures, footers and PGP armor
+var dimmedLabels = map[string]string{
+	"signature": "signature",
+	"footer":    "mailing list footer",
+	"pgp":       "PGP armor",
+}
+
+// signatureMaxLines is the maximum length of signatures shown expanded
+const signatureMaxLines = 4
+
+// renderDimmed renders signature, footer or PGP armor as a collapsible block
+// excluded from search engine snippets
+func renderDimmed(b *bpi.BodyBlock) string {
+	open := ""
+	if b.Type == "signature" && strings.Count(b.Body, "\n") <= signatureMaxLines {
+		open = " open"
 	}
+
+	return "<details class='dimmed' data-nosnippet" + open + "><summary>" + dimmedLabels[b.Type] +
+		"</summary><pre>" + template.HTMLEscapeString(b.Body) + "</pre></details>"
 }
 
 const baseTpl = `{{define "base"}}
@@ -127,7 +332,8 @@ const baseTpl = `{{define "base"}}
 	<head>
 		<meta charset="UTF-8">
 		<title>{{block "title" .}}Test{{end}}</title>
-		<style>pre{white-space:pre-wrap}.quotes{color:#999};</style>
+		<style>pre{white-space:pre-wrap}.quotes{color:#999;margin:0}.q2{color:#79a}.q3{color:#a97}.attribution{font-style:italic}.qsrc{font-size:small}.dimmed{color:#999}.dimmed summary{cursor:pointer;font-size:small}.dimmed pre{margin:0}:target{background:#ffa}summary.quotes{cursor:pointer;font-size:small}.pass{color:#080}.fail{color:#c00}.unknown{color:#a60}.diff pre{margin:0}.expand{font-size:small}.sbs{border-collapse:collapse;width:100%;table-layout:fixed;font-family:monospace}.sbs td{white-space:pre-wrap;vertical-align:top;padding:0 4px}.sbs .lnc{width:3em}.sbs .ln{color:#999;text-align:right}.sbs .hh{color:#800080;background:#f0f0ff}.sbs .del{background:#fee}.sbs .add{background:#efe}.sbs .empty{background:#f8f8f8}.wdel{background:#fbb}.wadd{background:#bfb}.comment{margin:4px 0 4px 2em;padding:2px 6px;border-left:3px solid #fc3;background:#ffd;white-space:normal}</style>
+		{{template "expandScript"}}
 	</head>
 	<body>
 	{{template "content" .}}
@@ -135,21 +341,25 @@ const baseTpl = `{{define "base"}}
 </html>
 {{end}}`
 
-var baseT = template.Must(template.Must(template.Must(template.New("base").
+var baseT = template.Must(template.Must(template.Must(template.Must(template.Must(template.Must(template.Must(template.New("base").
 	Funcs(funcs).
 	Parse(baseTpl)).
 	Parse(replyInstructionsTpl)).
-	Parse(threadOverviewTpl))
+	Parse(threadOverviewTpl)).
+	Parse(threadSkeletonTpl)).
+	Parse(threadLinksOverviewTpl)).
+	Parse(badgesTpl)).
+	Parse(expandScriptTpl))
 
 const replyInstructionsTpl = `
 {{define "replyInstructions"}}
-<pre id="R"><string>Reply instructions:</strong>
+<pre id="R"><strong>Reply instructions:</strong>
 
-You may reply publically to <a href="#t">this message</a> via plain-text email
+You may reply publically to <a href="../{{ .ID }}/">this message</a> via plain-text email
 using any one of the following methods:
 
 * Save the following mbox file, import it into your mail client,
-  and reply-to-all from there: <a href="raw">mbox</a>
+  and reply-to-all from there: <a href="../{{ .ID }}/raw">mbox</a>
 
   Avoid top-posting and favor interleaved quoting:
   <a href="https://en.wikipedia.org/wiki/Posting_style#Interleaved_style">https://en.wikipedia.org/wiki/Posting_style#Interleaved_style</a>
@@ -160,14 +370,14 @@ using any one of the following methods:
   switches of git-send-email(1):
 
   git send-email \
-    --in-reply-to='r6a3cRnCmsfOm9mlbjvsQu4T2g2041vFpSGczjpOTuoxUYjtijyZcLZyz4f5Bc8dt45ePRSFsHWVL9RlKId6q9GcnFAlQ_Cd-x0ZBk4s27E=@protonmail.com' \
-    --to=yscheffer@protonmail.com \
-    --cc=meta@public-inbox.org \
+    --in-reply-to='{{ .ID }}' \
+    --to={{ .To.Address }} \{{range .Cc}}
+    --cc={{ .Address }} \{{end}}
     /path/to/YOUR_REPLY
 
   <a href="https://kernel.org/pub/software/scm/git/docs/git-send-email.html">https://kernel.org/pub/software/scm/git/docs/git-send-email.html</a>
 
 * If your mail client supports setting the <b>In-Reply-To</b> header
-  via mailto: links, try the <a href="">mailto: link</a>
+  via mailto: links, try the <a href="{{ .Mailto }}">mailto: link</a>
 </pre>
 {{end}}`
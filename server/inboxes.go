@@ -0,0 +1,235 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+	"github.com/smacker/better-public-inbox"
+)
+
+// Inbox is a mailing list archive served by MultiServer
+type Inbox struct {
+	Name        string
+	Description string
+	Address     string
+	Store       bpi.Store
+	// Options are applied to the server of the inbox after the common options
+	Options []Option
+}
+
+// MultiServer serves several inboxes mounted at "/{inbox}/"
+// with the list of inboxes and Message-ID lookup in all of them at the top level
+type MultiServer struct {
+	inboxes []*Inbox
+	mux     http.Handler
+}
+
+// NewMultiServer creates MultiServer, options are applied to servers of all inboxes
+func NewMultiServer(inboxes []*Inbox, opts ...Option) *MultiServer {
+	r := chi.NewRouter()
+	s := &MultiServer{
+		inboxes: inboxes,
+		mux:     r,
+	}
+
+	r.Use(s.inboxRootRedirect)
+
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.RequestID)
+		r.Use(middleware.Logger)
+		r.Use(middleware.Recoverer)
+
+		r.Get("/", s.render(s.indexHandler))
+		r.Get("/favicon.ico", http.NotFound)
+		r.Get("/{id}", s.render(s.lookupHandler))
+		r.Get("/{id}/*", s.render(s.lookupHandler))
+	})
+
+	for _, inbox := range inboxes {
+		inboxOpts := append([]Option{}, opts...)
+		inboxOpts = append(inboxOpts, inbox.Options...)
+		inboxOpts = append(inboxOpts, WithListAddress(inbox.Address), withLookup(s.exists))
+
+		r.Mount("/"+inbox.Name, NewHTTPServer(inbox.Store, inboxOpts...))
+	}
+
+	return s
+}
+
+// withLookup sets the function checking other inboxes for messages missing in the inbox
+func withLookup(lookup func(id string) bool) Option {
+	return func(s *HTTPServer) {
+		s.lookup = lookup
+	}
+}
+
+func (s *MultiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// inboxRootRedirect adds the trailing slash to the inbox root, relative links of the inbox rely on it
+func (s *MultiServer) inboxRootRedirect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, inbox := range s.inboxes {
+			if r.URL.Path == "/"+inbox.Name {
+				http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *MultiServer) render(handler func(http.ResponseWriter, *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := handler(w, r); err != nil {
+			internalError(w, r, err)
+		}
+	}
+}
+
+// indexHandler lists inboxes with their last activity
+func (s *MultiServer) indexHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(inboxesTpl)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*inboxesTplItem, len(s.inboxes))
+	for i, inbox := range s.inboxes {
+		latest, err := inbox.Store.Latest()
+		if err != nil {
+			return err
+		}
+
+		items[i] = &inboxesTplItem{Inbox: inbox, Latest: latest}
+	}
+
+	return t.Execute(w, items)
+}
+
+type inboxesTplItem struct {
+	*Inbox
+	Latest *bpi.MessageHeader
+}
+
+// inboxMessage is a message found in the inbox
+type inboxMessage struct {
+	*bpi.MessageHeader
+	Inbox string
+	URL   string
+}
+
+// find looks up the Message-ID in all inboxes,
+// exact matches are preferred to truncated Message-IDs
+func (s *MultiServer) find(id string) []*inboxMessage {
+	clean := bpi.CleanMessageID(id)
+
+	var exact, partial []*inboxMessage
+	for _, inbox := range s.inboxes {
+		list, err := inbox.Store.Resolve(id)
+		if err != nil {
+			logrus.Warnf("can not resolve Message-ID '%s' in inbox %s: %s", id, inbox.Name, err)
+			continue
+		}
+
+		for _, m := range list {
+			item := &inboxMessage{
+				MessageHeader: m,
+				Inbox:         inbox.Name,
+				URL:           "/" + inbox.Name + "/" + url.PathEscape(m.ID) + "/",
+			}
+
+			if strings.EqualFold(m.ID, clean) {
+				exact = append(exact, item)
+			} else {
+				partial = append(partial, item)
+			}
+		}
+	}
+
+	if len(exact) > 0 {
+		return exact
+	}
+
+	return partial
+}
+
+// exists returns true if the Message-ID refers to a message in any inbox
+func (s *MultiServer) exists(id string) bool {
+	return len(s.find(id)) > 0
+}
+
+// lookupHandler redirects the Message-ID to the inbox of the message
+// keeping the rest of the path or lists inboxes having messages with the Message-ID
+func (s *MultiServer) lookupHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(lookupTpl)
+	if err != nil {
+		return err
+	}
+
+	id := chi.URLParam(r, "id")
+	list := s.find(id)
+
+	rest := strings.TrimSuffix(chi.URLParam(r, "*"), "/")
+	if rest != "" {
+		rest += "/"
+	}
+
+	switch len(list) {
+	case 0:
+		w.WriteHeader(http.StatusNotFound)
+	case 1:
+		target := list[0].URL + rest
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+
+		http.Redirect(w, r, target, http.StatusFound)
+		return nil
+	default:
+		w.WriteHeader(http.StatusMultipleChoices)
+	}
+
+	return t.Execute(w, struct {
+		ID    string
+		Rest  string
+		Items []*inboxMessage
+	}{ID: id, Rest: rest, Items: list})
+}
+
+const inboxesTpl = `
+{{define "title"}}inboxes{{end}}
+{{define "content"}}
+<pre>
+{{range $inbox := .}}
+<a href="{{ .Name }}/"><strong>{{ .Name }}</strong></a>{{with .Address}} &lt;{{ . }}&gt;{{end}}
+{{with .Description}}{{ . }}
+{{end}}{{with .Latest}}last activity: {{ .Date.UTC.Format "2006-01-02 15:04:05 UTC" }} <a href="{{ $inbox.Name }}/{{ .ID }}/">{{ .Title }}</a>{{else}}no messages{{end}}
+{{else}}
+No inboxes
+{{end}}
+</pre>
+{{end}}`
+
+const lookupTpl = `
+{{define "title"}}Message-ID &lt;{{ .ID }}&gt;{{end}}
+{{define "content"}}
+<pre>
+{{if .Items}}<strong>Message-ID &lt;{{ .ID }}&gt; is found in several inboxes:</strong>
+{{range .Items}}
+<a href="{{ .URL }}{{ $.Rest }}">{{ .Title }}</a>
+  {{ .Inbox }}: &lt;{{ .ID }}&gt; {{ .Author.Name }} @ {{ .Date.UTC.Format "2006-01-02 15:04" }}{{end}}
+{{else}}<strong>404 Not Found</strong>
+
+Message-ID &lt;{{ .ID }}&gt; is not found in any inbox
+{{end}}
+back to <a href="/">inboxes</a>
+</pre>
+{{end}}`
@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
 	"github.com/smacker/better-public-inbox"
 )
 
@@ -21,28 +22,80 @@ func (s *HTTPServer) msgHandler(w http.ResponseWriter, r *http.Request) error {
 		return err
 	}
 
+	pos, err := s.ts.Position(m.ID)
+	if err != nil {
+		return err
+	}
+
+	opts := s.renderOptions(w, r)
+
+	var apply *bpi.ApplyResult
+	if s.repo != nil {
+		apply, err = s.repo.CheckApply(m)
+		if err != nil {
+			logrus.Warnf("can not check patch '%s': %s", m.ID, err)
+		}
+	}
+
 	return t.Execute(w, struct {
-		Msg *bpi.Message
-	}{Msg: m})
+		Msg    *bpi.Message
+		Apply  *bpi.ApplyResult
+		Commit *bpi.Commit
+		Solver bool
+		PGP    *bpi.PGPVerification
+		Reply  *replyTplData
+		Pos    *bpi.Position
+		Render *renderOptions
+	}{Msg: m, Pos: pos, Render: opts, Apply: apply, Commit: s.mergedCommit(m.ID), Solver: s.solver != nil, PGP: s.verifyPGP(m), Reply: s.reply(m)})
 }
 
 const msgTpl = `
 {{define "title"}}{{ .Msg.Title }}{{end}}
 {{define "content"}}
 <pre id="b">
-From: {{ .Msg.Author.Name }} <{{ .Msg.Author.Address }}>
-To: {{ .Msg.To }}
-Subject: <a href="#r">{{ .Msg.Title }}</a>
-Date: {{ .Msg.Date }}
-Message-ID: <{{ .Msg.ID }}> (<a href="raw">raw</a>)
-
-{{ .Msg.Description }}
-{{ .Msg.Patch | htmlPatch }}
+From: {{ .Msg.Author.Name }} <{{ .Msg.Author.Address }}>{{if .Msg.SentByOther}} (authored by {{ .Msg.Author.Name }}, sent by {{ .Msg.Sender.Name }} <{{ .Msg.Sender.Address }}>){{end}}
+To: {{ addresses .Msg.To }}{{if .Msg.Cc}}
+Cc: {{ addresses .Msg.Cc }}{{end}}
+Subject: <a href="../{{ .Msg.ID }}/T/#m{{ .Msg.ID | idshort }}">{{ .Msg.Title }}</a>
+Date: {{ .Msg.Date.Format "2006-01-02 15:04:05 UTC" }}{{if not (.Msg.AuthorDate.Equal .Msg.Date)}} (authored {{ .Msg.AuthorDate.Format "2006-01-02 15:04:05 UTC" }}){{end}}
+Message-ID: <{{ .Msg.ID }}> (<a href="../{{ .Msg.ID }}/raw">raw</a> / <a href="../{{ .Msg.ID }}/headers">all headers</a>)
+{{with .Msg.DKIM}}{{template "dkimBadge" .}}
+{{end}}{{with .Msg.Attestation}}{{template "attestationBadge" .}}
+{{end}}{{with .PGP}}{{template "pgpBadge" .}}
+{{end}}{{if .Msg.SignOff}}{{template "badges" .Msg}}
+{{end}}{{with .Apply}}{{template "applyBadge" .}}
+{{end}}{{with .Commit}}{{template "mergedBadge" .}}
+{{end}}{{if and .Solver .Apply}}<a href="../{{ .Msg.ID }}/s/">changed files after the patch</a>
+{{end}}{{if .Msg.Patch}}<a href="../{{ .Msg.ID }}/series/">series</a>
+{{end}}diff view: {{if .Render.Split}}<a href="?diff=unified">unified</a> | side-by-side{{else}}unified | <a href="?diff=split">side-by-side</a>{{end}}
 </pre>
+{{range .Msg.Body}}
+{{renderBlock $.Render $.Msg . }}
+{{end}}{{if .Msg.Reviews}}
+<pre>{{range .Msg.Reviews}}
+<strong>{{ . }}</strong>{{end}}
+</pre>{{end}}
 <hr>
 <pre>
-<a href="" rel="next">next</a>             <a href="#r">reply</a> <a href="../">index</a>
+{{with .Pos}}{{with .Next}}<a href="../{{ .ID }}/" rel="next">next</a>{{else}}next{{end}} {{with .Prev}}<a href="../{{ .ID }}/" rel="prev">prev</a>{{else}}prev{{end}} {{with .Parent}}<a href="../{{ .ID }}/">parent</a>{{else}}parent{{end}} {{with .Root}}<a href="../{{ .ID }}/">root</a>{{end}}  siblings: {{with .PrevSibling}}<a href="../{{ .ID }}/">older</a>{{else}}older{{end}} {{with .NextSibling}}<a href="../{{ .ID }}/">newer</a>{{else}}newer{{end}}{{end}}  <a href="#R">reply</a> <a href="../">index</a>
+{{template "threadSkeleton" .Pos}}
 </pre>
 <hr>
-{{template "replyInstructions"}}
+{{template "replyInstructions" .Reply}}
+<hr>
+<pre>
+{{template "threadLinksOverview" .Pos}}
+</pre>
 {{end}}`
+
+// rawHandler returns the message as it was received
+func (s *HTTPServer) rawHandler(w http.ResponseWriter, r *http.Request) error {
+	raw, err := s.ts.Raw(chi.URLParam(r, "id"))
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, err = w.Write(raw)
+	return err
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/smacker/better-public-inbox"
+)
+
+// quotes blocks longer than quoteFoldLines are collapsed except the last quoteTailLines
+const (
+	quoteFoldLines = 12
+	quoteTailLines = 3
+)
+
+// renderQuotes renders quotes block with its attribution, long blocks are collapsed,
+// with a link to the quoted paragraph of the original message
+func renderQuotes(opts *renderOptions, b *bpi.BodyBlock) string {
+	level := b.Level
+	if level > 3 {
+		level = 3
+	}
+	class := fmt.Sprintf("quotes q%d", level)
+
+	var result string
+	switch true {
+	case b.Attribution != "" && b.Source != nil:
+		result = "<pre class='" + class + " attribution'><a href='" + template.HTMLEscapeString(quoteSourceURL(opts, b.Source)) + "'>" +
+			template.HTMLEscapeString(b.Attribution) + "</a></pre>"
+	case b.Attribution != "":
+		result = "<pre class='" + class + " attribution'>" + template.HTMLEscapeString(b.Attribution) + "</pre>"
+	case b.Source != nil:
+		result = "<a class='qsrc' href='" + template.HTMLEscapeString(quoteSourceURL(opts, b.Source)) + "'>&uarr; quoted message</a>"
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(b.Body, "\n"), "\n")
+	if b.Body == "" {
+		return result
+	}
+	if len(lines) <= quoteFoldLines {
+		return result + "<pre class='" + class + "'>" + template.HTMLEscapeString(b.Body) + "</pre>"
+	}
+
+	head := lines[:len(lines)-quoteTailLines]
+	tail := lines[len(lines)-quoteTailLines:]
+
+	return result + fmt.Sprintf("<details><summary class='%s'>%d quoted lines hidden</summary><pre class='%s'>%s</pre></details><pre class='%s'>%s</pre>",
+		class, len(head), class, template.HTMLEscapeString(strings.Join(head, "")),
+		class, template.HTMLEscapeString(strings.Join(tail, "")+"\n"))
+}
+
+// paragraphAnchor returns id of the element with the paragraph of the message body block
+func paragraphAnchor(id string, block, paragraph int) string {
+	return fmt.Sprintf("q%.12s-%d-%d", idshort(id), block, paragraph)
+}
+
+// quoteSourceURL returns link to the paragraph the quotes were taken from
+func quoteSourceURL(opts *renderOptions, src *bpi.QuoteSource) string {
+	anchor := paragraphAnchor(src.ID, src.Block, src.Paragraph)
+	if opts.Thread {
+		return "#" + anchor
+	}
+
+	return opts.Root + url.PathEscape(src.ID) + "/T/#" + anchor
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/smacker/better-public-inbox"
+)
+
+// replyTplData is the data of reply instructions of a message
+type replyTplData struct {
+	ID     string
+	To     *mail.Address
+	Cc     []*mail.Address
+	Mailto string
+}
+
+// reply returns reply-to-all instructions for the message,
+// the list address is added to Cc unless the message was already sent to it
+func (s *HTTPServer) reply(m *bpi.Message) *replyTplData {
+	r := m.ReplyRecipients()
+
+	cc := r.Cc
+	if s.address != "" && !hasAddress(append(cc, r.To), s.address) {
+		cc = append(cc, &mail.Address{Address: s.address})
+	}
+
+	return &replyTplData{
+		ID:     m.ID,
+		To:     r.To,
+		Cc:     cc,
+		Mailto: mailto(m, r.To, cc),
+	}
+}
+
+func hasAddress(list []*mail.Address, address string) bool {
+	for _, addr := range list {
+		if strings.EqualFold(addr.Address, address) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mailto builds mailto: URL (RFC 6068) replying to the message
+func mailto(m *bpi.Message, to *mail.Address, cc []*mail.Address) string {
+	ccList := make([]string, len(cc))
+	for i, addr := range cc {
+		ccList[i] = mailtoEscape(addr.Address)
+	}
+
+	result := "mailto:" + mailtoEscape(to.Address) +
+		"?In-Reply-To=" + mailtoEscape("<"+m.ID+">")
+	if len(ccList) > 0 {
+		result += "&Cc=" + strings.Join(ccList, ",")
+	}
+
+	return result + "&Subject=" + mailtoEscape(replySubject(m.Title))
+}
+
+// mailtoEscape percent-encodes the value, mailto: URLs don't decode "+" as a space
+func mailtoEscape(s string) string {
+	return strings.Replace(url.QueryEscape(s), "+", "%20", -1)
+}
+
+// replySubject prefixes the subject with "Re:" unless it's a reply already
+func replySubject(subject string) string {
+	if len(subject) >= 3 && strings.EqualFold(subject[:3], "re:") {
+		return subject
+	}
+
+	return "Re: " + subject
+}
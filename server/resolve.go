@@ -0,0 +1,99 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/smacker/better-public-inbox"
+)
+
+// resolve redirects to the canonical URL when the missing Message-ID of the request refers
+// to exactly one message or shows the list of messages it may refer to,
+// returns false if nothing is found
+func (s *HTTPServer) resolve(w http.ResponseWriter, r *http.Request, err error) bool {
+	id := chi.URLParam(r, "id")
+	notFound, ok := errors.Cause(err).(*bpi.NotFoundError)
+	if id == "" || !ok || notFound.Kind != "message" {
+		return false
+	}
+
+	list, err := s.ts.Resolve(id)
+	if err != nil {
+		logrus.Warnf("can not resolve Message-ID '%s': %s", id, err)
+		return false
+	}
+
+	switch true {
+	case len(list) == 0 && s.lookup != nil && s.lookup(id):
+		// the top-level page of the server finds the inbox with the message
+		http.Redirect(w, r, canonicalURL(r, relativeRoot(r)+"../", id), http.StatusFound)
+		return true
+	case len(list) == 0:
+		return false
+	case len(list) == 1 && strings.EqualFold(list[0].ID, bpi.CleanMessageID(id)) && list[0].ID != id:
+		// the mangled Message-ID always refers to the message
+		http.Redirect(w, r, canonicalURL(r, relativeRoot(r), list[0].ID), http.StatusMovedPermanently)
+		return true
+	case len(list) == 1 && list[0].ID != id:
+		// a new message can make the prefix ambiguous
+		http.Redirect(w, r, canonicalURL(r, relativeRoot(r), list[0].ID), http.StatusFound)
+		return true
+	case len(list) == 1:
+		return false
+	}
+
+	w.WriteHeader(http.StatusMultipleChoices)
+
+	items := make([]*resolveTplItem, len(list))
+	for i, m := range list {
+		items[i] = &resolveTplItem{MessageHeader: m, URL: canonicalURL(r, relativeRoot(r), m.ID)}
+	}
+
+	err = template.Must(template.Must(baseT.Clone()).Parse(resolveTpl)).Execute(w, struct {
+		ID    string
+		Items []*resolveTplItem
+		Root  string
+	}{ID: id, Items: items, Root: relativeRoot(r)})
+	if err != nil {
+		logrus.Errorf("can not render disambiguation page: %s", err)
+	}
+
+	return true
+}
+
+// canonicalURL returns URL of the same page for the Message-ID relative to the root
+func canonicalURL(r *http.Request, root string, id string) string {
+	// the pattern of the route inside of the mounted router
+	patterns := chi.RouteContext(r.Context()).RoutePatterns
+	pattern := patterns[len(patterns)-1]
+
+	path := root + strings.TrimPrefix(strings.Replace(pattern, "{id}", url.PathEscape(id), 1), "/") + "/"
+	if r.URL.RawQuery != "" {
+		path += "?" + r.URL.RawQuery
+	}
+
+	return path
+}
+
+type resolveTplItem struct {
+	*bpi.MessageHeader
+	URL string
+}
+
+const resolveTpl = `
+{{define "title"}}Message-ID &lt;{{ .ID }}&gt; is ambiguous{{end}}
+{{define "content"}}
+<pre>
+<strong>Message-ID &lt;{{ .ID }}&gt; matches several messages:</strong>
+{{range .Items}}
+<a href="{{ .URL }}">{{ .Title }}</a>
+  &lt;{{ .ID }}&gt; {{ .Author.Name }} @ {{ .Date.UTC.Format "2006-01-02 15:04" }}{{end}}
+
+back to <a href="{{ .Root }}">index</a>
+</pre>
+{{end}}`
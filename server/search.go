@@ -0,0 +1,43 @@
+package server
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/smacker/better-public-inbox"
+)
+
+// searchHandler lists messages matching the query by subject or Message-ID
+func (s *HTTPServer) searchHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(searchTpl)
+	if err != nil {
+		return err
+	}
+
+	query := r.URL.Query().Get("q")
+
+	list, err := s.ts.Search(query)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, struct {
+		Query string
+		Items []*bpi.MessageHeader
+	}{Query: query, Items: list})
+}
+
+const searchTpl = `
+{{define "title"}}search: {{ .Query }}{{end}}
+{{define "content"}}
+<form action="search"><pre>Search by subject or Message-ID: <input name="q" value="{{ .Query }}"> <input type="submit" value="search"></pre></form>
+<pre>
+{{range .Items}}
+<a href="{{ .ID }}/"><strong>{{ .Title }}</strong></a>
+{{ .Author.Name }} @ {{ .Date.UTC.Format "2006-01-02 15:04:05 UTC" }}
+{{else}}{{if .Query}}
+No messages found
+{{end}}{{end}}
+back to <a href="./">index</a>
+</pre>
+{{end}}`
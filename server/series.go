@@ -0,0 +1,240 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/sirupsen/logrus"
+	"github.com/smacker/better-public-inbox"
+)
+
+func (s *HTTPServer) seriesHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(seriesTpl)
+	if err != nil {
+		return err
+	}
+
+	id := chi.URLParam(r, "id")
+
+	series, err := s.ts.Series(id)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*seriesTplItem, len(series.Patches))
+	patches := make([]*bpi.Message, len(series.Patches))
+	for i, p := range series.Patches {
+		item := &seriesTplItem{Number: i + 1}
+		items[i] = item
+		if p == nil {
+			continue
+		}
+
+		item.Msg, err = s.ts.Message(p.ID)
+		if err != nil {
+			return err
+		}
+		patches[i] = item.Msg
+
+		item.Msg.Reviews, err = s.ts.Reviews(p.ID)
+		if err != nil {
+			return err
+		}
+
+		item.Diffstat, err = diffstat(item.Msg)
+		if err != nil {
+			logrus.Warnf("can not make diffstat of patch '%s': %s", p.ID, err)
+		}
+
+		item.Commit = s.mergedCommit(p.ID)
+	}
+
+	return t.Execute(w, struct {
+		Series     *bpi.Series
+		Items      []*seriesTplItem
+		Solver     bool
+		AttestedBy string
+	}{
+		Series:     series,
+		Items:      items,
+		Solver:     s.solver != nil,
+		AttestedBy: bpi.AttestedBy(patches),
+	})
+}
+
+func (s *HTTPServer) rangeDiffHandler(w http.ResponseWriter, r *http.Request) error {
+	t, err := template.Must(baseT.Clone()).Parse(rangeDiffTpl)
+	if err != nil {
+		return err
+	}
+
+	id := chi.URLParam(r, "id")
+
+	series, err := s.ts.Series(id)
+	if err != nil {
+		return err
+	}
+
+	from := series.Previous()
+	if v := r.URL.Query().Get("from"); v != "" {
+		from = nil
+		if version, err := strconv.Atoi(v); err == nil {
+			from = series.FindVersion(version)
+		}
+	}
+	if from == nil {
+		return &bpi.NotFoundError{Kind: "previous version of series", ID: id}
+	}
+
+	oldMsgs, err := s.seriesMessages(from)
+	if err != nil {
+		return err
+	}
+
+	newMsgs, err := s.seriesMessages(series)
+	if err != nil {
+		return err
+	}
+
+	changes, err := bpi.RangeDiff(oldMsgs, newMsgs)
+	if err != nil {
+		return err
+	}
+
+	return t.Execute(w, struct {
+		From    *bpi.Series
+		To      *bpi.Series
+		Changes []*bpi.PatchChange
+	}{
+		From:    from,
+		To:      series,
+		Changes: changes,
+	})
+}
+
+// seriesMessages loads patches of the series, missing patches are nil
+func (s *HTTPServer) seriesMessages(series *bpi.Series) ([]*bpi.Message, error) {
+	result := make([]*bpi.Message, len(series.Patches))
+	for i, p := range series.Patches {
+		if p == nil {
+			continue
+		}
+
+		m, err := s.ts.Message(p.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		result[i] = m
+	}
+
+	return result, nil
+}
+
+type seriesTplItem struct {
+	Number   int
+	Msg      *bpi.Message
+	Diffstat string
+	Commit   *bpi.Commit
+}
+
+const diffstatGraphWidth = 50
+
+// diffstat returns git-like diffstat of all patch blocks of the message
+func diffstat(m *bpi.Message) (string, error) {
+	diffs, err := m.Diffs()
+	if err != nil {
+		return "", err
+	}
+
+	if len(diffs) == 0 {
+		return "", nil
+	}
+
+	var width, maxChanged int
+	for _, d := range diffs {
+		if len(d.Name()) > width {
+			width = len(d.Name())
+		}
+
+		added, deleted := d.Stat()
+		if added+deleted > maxChanged {
+			maxChanged = added + deleted
+		}
+	}
+
+	var lines []string
+	var totalAdded, totalDeleted int
+	for _, d := range diffs {
+		added, deleted := d.Stat()
+		changed := added + deleted
+		totalAdded += added
+		totalDeleted += deleted
+
+		// scale the graph like git does for large changes
+		if maxChanged > diffstatGraphWidth {
+			added = (added*diffstatGraphWidth + maxChanged - 1) / maxChanged
+			deleted = (deleted*diffstatGraphWidth + maxChanged - 1) / maxChanged
+		}
+
+		lines = append(lines, fmt.Sprintf(" %-*s | %4d %s%s",
+			width, d.Name(), changed, strings.Repeat("+", added), strings.Repeat("-", deleted)))
+	}
+	lines = append(lines, fmt.Sprintf(" %s changed, %s(+), %s(-)",
+		plural(len(diffs), "file"), plural(totalAdded, "insertion"), plural(totalDeleted, "deletion")))
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+const seriesTpl = `
+{{define "title"}}{{ .Series.Title }}{{end}}
+{{define "content"}}
+<pre>
+<strong>{{ .Series.Title }}</strong>
+From: {{ .Series.Author.Name }} @ {{ .Series.Date.UTC.Format "2006-01-02 15:04:05 UTC" }} (<a href="../../{{ .Series.ID }}/T/">thread</a>)
+Version: v{{ .Series.Version }}, {{ .Series.Received }}/{{ .Series.Total }} received{{if not .Series.Complete}} (incomplete){{end}}
+{{with .AttestedBy}}<span class="pass">[all patches attested by {{ . }}]</span>
+{{end}}{{if gt (len .Series.Versions) 1}}Versions:{{range .Series.Versions}} {{if eq . $.Series}}v{{ .Version }}{{else}}<a href="../../{{ .ID }}/series/">v{{ .Version }}</a>{{end}}{{end}}
+{{with .Series.Previous}}Changes since v{{ .Version }}: <a href="../../{{ $.Series.ID }}/series/range-diff?from={{ .Version }}">range-diff</a>
+{{end}}{{end}}{{with .Series.Cover}}
+<a href="../../{{ .ID }}/">{{ .Title }}</a>
+{{end}}{{range .Items}}{{if .Msg}}
+<a href="../../{{ .Msg.ID }}/">{{ .Msg.Title }}</a>{{if $.Solver}} (<a href="../../{{ .Msg.ID }}/s/">files</a>){{end}}{{with .Commit}} {{template "mergedBadge" .}}{{end}}{{if not $.AttestedBy}}{{with .Msg.Attestation}} {{template "attestationBadge" .}}{{end}}{{end}}
+{{ .Diffstat }}
+{{range .Msg.Reviews}}    {{ . }}
+{{end}}{{else}}
+[{{ .Number }}/{{ $.Series.Total }}] not received
+{{end}}{{end}}
+back to <a href="../..">index</a>
+</pre>
+{{end}}`
+
+const rangeDiffTpl = `
+{{define "title"}}range-diff v{{ .From.Version }}..v{{ .To.Version }}: {{ .To.Title }}{{end}}
+{{define "content"}}
+<pre>
+<strong>{{ .To.Title }}</strong>
+Changes between <a href="../../{{ .From.ID }}/series/">v{{ .From.Version }}</a> and <a href="../../{{ .To.ID }}/series/">v{{ .To.Version }}</a>
+</pre>
+{{range .Changes}}
+<pre>
+{{with .Old}}<a href="../../{{ .ID }}/">{{ .Patch.Number }}</a>{{else}}-{{end}} {{ .Status }} {{with .New}}<a href="../../{{ .ID }}/">{{ .Patch.Number }}</a> {{ .Patch.Title }}{{else}}- {{ .Old.Patch.Title }}{{end}}
+</pre>
+{{ htmlDiff .Interdiff }}
+{{end}}
+<pre>
+back to <a href="../../{{ .To.ID }}/series/">series</a>
+</pre>
+{{end}}`
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+
+	"github.com/smacker/better-public-inbox"
+)
+
+const splitTableStart = `<table class="sbs"><colgroup><col class="lnc"><col><col class="lnc"><col></colgroup>`
+
+// splitRow is a row of side-by-side diff, zero line number means empty cell
+type splitRow struct {
+	oldNo, newNo int
+	old, new     string
+	changed      bool
+	// lines are indexes of hunk lines shown in the row
+	lines []int
+}
+
+// renderSplitHunk renders hunk as a two-column old/new table
+// with comments under the rows of commented lines
+func renderSplitHunk(opts *renderOptions, h *bpi.Hunk, comments map[int][]*bpi.LineComment) string {
+	var rows []*splitRow
+	var dels, adds []string
+	var delLines, addLines []int
+
+	oldNo, newNo := h.OldStart, h.NewStart
+	flush := func() {
+		for i := 0; i < len(dels) || i < len(adds); i++ {
+			row := &splitRow{changed: true}
+			if i < len(dels) {
+				row.oldNo = oldNo
+				row.old = dels[i]
+				row.lines = append(row.lines, delLines[i])
+				oldNo++
+			}
+			if i < len(adds) {
+				row.newNo = newNo
+				row.new = adds[i]
+				row.lines = append(row.lines, addLines[i])
+				newNo++
+			}
+			rows = append(rows, row)
+		}
+		dels, adds = nil, nil
+		delLines, addLines = nil, nil
+	}
+
+	for k, line := range h.Lines {
+		switch line[0] {
+		case '-':
+			dels = append(dels, line[1:])
+			delLines = append(delLines, k)
+		case '+':
+			adds = append(adds, line[1:])
+			addLines = append(addLines, k)
+		case '\\':
+			// "\ No newline at end of file" marker isn't a line of the file
+		default:
+			flush()
+			rows = append(rows, &splitRow{oldNo: oldNo, newNo: newNo, old: line[1:], new: line[1:], lines: []int{k}})
+			oldNo++
+			newNo++
+		}
+	}
+	flush()
+
+	var b strings.Builder
+	b.WriteString(splitTableStart)
+	b.WriteString(`<tr><td colspan="4" class="hh">` + template.HTMLEscapeString(h.Header()) + `</td></tr>`)
+	for _, row := range rows {
+		b.WriteString(renderSplitRow(row))
+		for _, k := range row.lines {
+			if len(comments[k]) > 0 {
+				b.WriteString(`<tr><td colspan="4">` + renderComments(opts, comments[k]) + `</td></tr>`)
+			}
+		}
+	}
+	b.WriteString(`</table>`)
+
+	return b.String()
+}
+
+// renderSplitContext renders pre-image lines as context rows of side-by-side diff,
+// delta is the difference between new and old line numbers
+func renderSplitContext(lines []string, from, delta int) string {
+	var b strings.Builder
+	b.WriteString(splitTableStart)
+	for i, line := range lines {
+		b.WriteString(renderSplitRow(&splitRow{oldNo: from + i, newNo: from + i + delta, old: line, new: line}))
+	}
+	b.WriteString(`</table>`)
+
+	return b.String()
+}
+
+func renderSplitRow(row *splitRow) string {
+	oldHTML, newHTML := template.HTMLEscapeString(row.old), template.HTMLEscapeString(row.new)
+	if row.changed && row.oldNo != 0 && row.newNo != 0 {
+		oldHTML, newHTML = wordDiff(row.old, row.new)
+	}
+
+	cell := func(no int, html, class string) string {
+		if no == 0 {
+			return `<td class="ln"></td><td class="empty"></td>`
+		}
+		if !row.changed {
+			class = ""
+		}
+
+		return fmt.Sprintf(`<td class="ln">%d</td><td class="%s">%s</td>`, no, class, html)
+	}
+
+	return "<tr>" + cell(row.oldNo, oldHTML, "del") + cell(row.newNo, newHTML, "add") + "</tr>"
+}
+
+var wordRe = regexp.MustCompile(`\w+|\s+|.`)
+
+// wordDiff highlights changed words of the old and the new line
+func wordDiff(old, new string) (string, string) {
+	// join adjacent edits of the same kind to highlight whole changed segments
+	var edits []bpi.Edit
+	for _, e := range bpi.DiffStrings(wordRe.FindAllString(old, -1), wordRe.FindAllString(new, -1)) {
+		if len(edits) > 0 && edits[len(edits)-1].Op == e.Op {
+			edits[len(edits)-1].Text += e.Text
+			continue
+		}
+		edits = append(edits, e)
+	}
+
+	var oldHTML, newHTML strings.Builder
+	for _, e := range edits {
+		text := template.HTMLEscapeString(e.Text)
+		switch e.Op {
+		case bpi.EditEqual:
+			oldHTML.WriteString(text)
+			newHTML.WriteString(text)
+		case bpi.EditDelete:
+			oldHTML.WriteString(`<span class="wdel">` + text + `</span>`)
+		case bpi.EditInsert:
+			newHTML.WriteString(`<span class="wadd">` + text + `</span>`)
+		}
+	}
+
+	return oldHTML.String(), newHTML.String()
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+
+	"github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/go-chi/chi"
+	"github.com/smacker/better-public-inbox"
+)
+
+// solverHandler shows post-image of a file changed by the patch
+// or the list of changed files if the path isn't specified
+func (s *HTTPServer) solverHandler(w http.ResponseWriter, r *http.Request) error {
+	if s.solver == nil {
+		return &bpi.NotFoundError{Kind: "post-image of message", ID: chi.URLParam(r, "id")}
+	}
+
+	t, err := template.Must(baseT.Clone()).Parse(solverTpl)
+	if err != nil {
+		return err
+	}
+
+	id := chi.URLParam(r, "id")
+	path := r.URL.Query().Get("b")
+
+	m, err := s.ts.Message(id)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := m.Diffs()
+	if err != nil {
+		return err
+	}
+
+	data := struct {
+		Msg   *bpi.Message
+		Diffs []*bpi.FileDiff
+		Path  string
+		File  template.HTML
+		Error string
+	}{
+		Msg:   m,
+		Diffs: diffs,
+		Path:  path,
+	}
+
+	if path != "" {
+		var diff *bpi.FileDiff
+		for _, d := range diffs {
+			if d.Name() == path {
+				diff = d
+				break
+			}
+		}
+		if diff == nil {
+			return &bpi.NotFoundError{Kind: "changed file", ID: path}
+		}
+
+		content, err := s.solver.PostImage(diff)
+		switch true {
+		case err == bpi.ErrNotReady:
+			return err
+		case err != nil:
+			data.Error = err.Error()
+		default:
+			data.File, err = formatFile(path, string(content), diff.AddedLines())
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return t.Execute(w, data)
+}
+
+// formatFile highlights the file using lexer matched by the path
+// and marks lines with the numbers
+func formatFile(path, content string, lines []int) (template.HTML, error) {
+	lexer := lexers.Match(path)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	ranges := make([][2]int, len(lines))
+	for i, n := range lines {
+		ranges[i] = [2]int{n, n}
+	}
+
+	formatter := html.New(html.WithLineNumbers(), html.HighlightLines(ranges))
+	iterator, err := lexer.Tokenise(nil, content)
+	if err != nil {
+		return "", err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := formatter.Format(buf, styles.Get("pygments"), iterator); err != nil {
+		return "", err
+	}
+
+	return template.HTML(buf.String()), nil
+}
+
+const solverTpl = `
+{{define "title"}}{{if .Path}}{{ .Path }}{{else}}{{ .Msg.Title }}{{end}}{{end}}
+{{define "content"}}
+<pre>
+<a href="../../{{ .Msg.ID }}/">{{ .Msg.Title }}</a>
+{{range .Diffs}}
+<a href="../../{{ $.Msg.ID }}/s/?b={{ .Name }}">{{ .Name }}</a> {{ .OldIndex }}..{{ .NewIndex }}{{end}}
+</pre>
+{{if .Path}}<hr>
+<pre><strong>{{ .Path }}</strong> after the patch, added lines are highlighted</pre>
+{{if .Error}}<pre class="fail">{{ .Error }}</pre>{{else}}{{ .File }}{{end}}{{end}}
+{{end}}`
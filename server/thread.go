@@ -23,30 +23,53 @@ func (s *HTTPServer) threadHandler(w http.ResponseWriter, r *http.Request) error
 
 	list := root.List()
 
+	opts := s.renderOptions(w, r)
+	opts.Thread = true
+
+	pgp := make(map[string]*bpi.PGPVerification)
+	for _, item := range list {
+		if v := s.verifyPGP(item.Message); v != nil {
+			pgp[item.ID] = v
+		}
+	}
+
 	return t.Execute(w, struct {
 		Root        *bpi.Message
 		Items       []*bpi.TreeMessage
 		ThreadCount int
+		Render      *renderOptions
+		PGP         map[string]*bpi.PGPVerification
 	}{
 		Root:        list[0].Message,
 		Items:       list,
 		ThreadCount: len(list),
+		Render:      opts,
+		PGP:         pgp,
 	})
 }
 
 const threadTpl = `
 {{define "title"}}{{ .Root.Title }}{{end}}
-{{define "content"}}{{range $i, $e := .Items}}
+{{define "content"}}
+<pre>diff view: {{if .Render.Split}}<a href="?diff=unified">unified</a> | side-by-side{{else}}unified | <a href="?diff=split">side-by-side</a>{{end}}</pre>
+{{range $i, $e := .Items}}
 <pre {{if not $i}}id="b"{{end}}>
 <a id="m{{ .ID | idshort }}" href="e{{ .ID | idshort }}">*</a> <strong>{{ .Title }}</strong>
-From: {{ .Author.Name }} @ {{ .Date.Format "2006-01-02 15:04:05 UTC" }} (<a href="">permalink</a> / <a href="">raw</a>)
-  To: {{ .To }}; <strong>+Cc:</strong> {{ .Cc }}
+From: {{if .SentByOther}}authored by {{ .Author.Name }}, sent by {{ .Sender.Name }}{{else}}{{ .Author.Name }}{{end}} @ {{ .Date.Format "2006-01-02 15:04:05 UTC" }} (<a href="../../{{ .ID }}/">permalink</a> / <a href="../../{{ .ID }}/raw">raw</a> / <a href="../../{{ .ID }}/headers">headers</a>)
+  To: {{ names .To }}{{if .Cc}}; <strong>+Cc:</strong> {{ names .Cc }}{{end}}{{with .DKIM}}
+{{template "dkimBadge" .}}{{end}}{{with .Attestation}}
+{{template "attestationBadge" .}}{{end}}{{with index $.PGP .ID}}
+{{template "pgpBadge" .}}{{end}}{{if .SignOff}}
+{{template "badges" .}}{{end}}
 </pre>
 {{range .Body }}
-{{renderBlock .Body .Type }}
-{{end}}
+{{renderBlock $.Render $e.Message . }}
+{{end}}{{if .Reviews}}
+<pre>{{range .Reviews}}
+<strong>{{ . }}</strong>{{end}}
+</pre>{{end}}
 <pre>
-<a id="e{{ .ID | idshort }}" href="m{{ .ID | idshort }}">^</a> <a href="../../{{ .ID }}/">permalink</a> <a href="../../{{ .ID }}/raw">raw</a>  <a href="../../{{ .ID }}/#R">reply</a>	<a href="#r{{ .ID | idshort }}">{{ $.ThreadCount }}+ messages in thread</a>
+<a id="e{{ .ID | idshort }}" href="m{{ .ID | idshort }}">^</a> <a href="../../{{ .ID }}/">permalink</a> <a href="../../{{ .ID }}/raw">raw</a>  <a href="../../{{ .ID }}/#R">reply</a>{{if .Patch}} <a href="../../{{ .ID }}/series/">series</a>{{end}}	<a href="#r{{ .ID | idshort }}">{{ $.ThreadCount }}+ messages in thread</a>
 </pre>
 <hr>{{end}}
 <pre>
@@ -7,3 +7,19 @@ const threadOverviewTpl = `
 {{range .}}{{ .Date.Format "2006-01-02 15:04" }} {{ repeat  "  " .Level }}<a id="r{{ .ID | idshort }}" href="#m{{ .ID | idshort }}">{{ .Title }}</a>
 {{end}}
 {{end}}`
+
+// threadLinksOverview is the overview of the thread for a page showing one of its messages
+const threadLinksOverviewTpl = `
+{{define "threadLinksOverview"}}
+<strong>Thread overview</strong>: {{ .ThreadCount }} messages / <a href="../{{ .ID }}/T/#m{{ .ID | idshort }}">expand</a>  <a href="#b">top</a>
+-- links below jump to the message in the thread --
+{{range .Thread}}{{ .Date.Format "2006-01-02 15:04" }} {{ repeat  "  " .Level }}{{if eq .ID $.ID}}<strong>{{ .Title }}</strong>{{else}}<a href="../{{ .ID }}/T/#m{{ .ID | idshort }}">{{ .Title }}</a>{{end}}
+{{end}}
+{{end}}`
+
+const threadSkeletonTpl = `
+{{define "threadSkeleton"}}
+<strong>Thread skeleton</strong>: {{ .ThreadCount }} messages / <a href="../{{ .ID }}/T/#m{{ .ID | idshort }}">expand</a>
+{{range .Skeleton}}{{ .Date.Format "2006-01-02 15:04" }} {{ repeat  "  " .Level }}{{if eq .ID $.ID}}<strong>{{ .Title }}</strong>{{else}}<a href="../{{ .ID }}/">{{ .Title }}</a>{{end}}
+{{end}}
+{{end}}`
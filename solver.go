@@ -0,0 +1,214 @@
+package bpi
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// solverMaxDepth is the maximum number of patches applied on top of a blob from the repository
+const solverMaxDepth = 10
+
+// solverMaxCandidates is the maximum number of patches tried to solve one blob
+const solverMaxCandidates = 100
+
+// Solver reconstructs blobs by applying patches from the archive
+// on top of blobs from the local git repository like public-inbox does
+type Solver struct {
+	repo  *GitRepo
+	store Store
+
+	// ready is closed when postImages are built
+	ready chan struct{}
+	// postImages maps short post-image blob id to patches which produce it
+	postImages map[string][]string
+}
+
+// NewSolver creates new Solver of blobs from the repository and patches from the store,
+// patches are indexed in background
+func NewSolver(repo *GitRepo, store Store) *Solver {
+	s := &Solver{
+		repo:  repo,
+		store: store,
+		ready: make(chan struct{}),
+	}
+	go s.index()
+
+	return s
+}
+
+// PostImage returns content of the file after applying the diff
+func (s *Solver) PostImage(d *FileDiff) ([]byte, error) {
+	pre, err := s.Blob(d.OldIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	post, err := d.Apply(pre)
+	if err != nil {
+		return nil, err
+	}
+
+	// deleted files have zero post-image id
+	if strings.Trim(d.NewIndex, "0") != "" && !sameBlob(blobID(post), d.NewIndex) {
+		return nil, errors.Errorf("post-image of %s doesn't match blob %s", d.Name(), d.NewIndex)
+	}
+
+	return post, nil
+}
+
+// PreImage returns content of the file before applying the diff
+func (s *Solver) PreImage(d *FileDiff) ([]byte, error) {
+	return s.Blob(d.OldIndex)
+}
+
+// Blob returns content of the blob by abbreviated id
+func (s *Solver) Blob(abbrev string) ([]byte, error) {
+	var tried int
+	return s.solve(abbrev, 0, &tried)
+}
+
+// solve reconstructs the blob, tried counts patches tried by all recursive calls
+func (s *Solver) solve(abbrev string, depth int, tried *int) ([]byte, error) {
+	if abbrev == "" {
+		return nil, errors.New("blob id is unknown")
+	}
+
+	// new file
+	if strings.Trim(abbrev, "0") == "" {
+		return []byte{}, nil
+	}
+
+	blobs, err := s.repo.ResolveBlobs([]string{abbrev})
+	if err != nil {
+		return nil, err
+	}
+
+	if full, ok := blobs[abbrev]; ok {
+		return s.repo.git(nil, nil, "cat-file", "blob", full)
+	}
+
+	if depth >= solverMaxDepth {
+		return nil, errors.Errorf("blob %s not found", abbrev)
+	}
+
+	candidates, err := s.patches(abbrev)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range candidates {
+		diffs, err := patchDiffs(s.store, id)
+		if err != nil {
+			continue
+		}
+
+		for _, d := range diffs {
+			if !sameBlob(d.NewIndex, abbrev) {
+				continue
+			}
+
+			*tried++
+			if *tried > solverMaxCandidates {
+				return nil, errors.Errorf("blob %s not found in %d patches", abbrev, solverMaxCandidates)
+			}
+
+			pre, err := s.solve(d.OldIndex, depth+1, tried)
+			if err != nil {
+				logrus.Debugf("can not solve pre-image of %s from '%s': %s", abbrev, id, err)
+				continue
+			}
+
+			post, err := d.Apply(pre)
+			if err != nil {
+				logrus.Debugf("can not apply '%s' to solve %s: %s", id, abbrev, err)
+				continue
+			}
+
+			if !sameBlob(blobID(post), abbrev) {
+				logrus.Debugf("patch '%s' produces different blob than %s", id, abbrev)
+				continue
+			}
+
+			return post, nil
+		}
+	}
+
+	return nil, errors.Errorf("blob %s not found", abbrev)
+}
+
+// index builds postImages from all patches of the store
+func (s *Solver) index() {
+	defer close(s.ready)
+
+	patches, err := s.store.Patches()
+	if err != nil {
+		logrus.Errorf("can not index patches for solver: %s", err)
+		return
+	}
+
+	postImages := make(map[string][]string)
+	for _, p := range patches {
+		diffs, err := patchDiffs(s.store, p.ID)
+		if err != nil {
+			continue
+		}
+
+		for _, d := range diffs {
+			if d.NewIndex != "" {
+				key := shortBlob(d.NewIndex)
+				postImages[key] = append(postImages[key], p.ID)
+			}
+		}
+	}
+
+	s.postImages = postImages
+}
+
+// patches returns Message-IDs of patches with the post-image blob,
+// returns ErrNotReady until all patches are indexed
+func (s *Solver) patches(abbrev string) ([]string, error) {
+	select {
+	case <-s.ready:
+	default:
+		return nil, ErrNotReady
+	}
+
+	return s.postImages[shortBlob(abbrev)], nil
+}
+
+// shortBlobLen is the minimal length of abbreviated blob ids used by git
+const shortBlobLen = 7
+
+func shortBlob(abbrev string) string {
+	if len(abbrev) > shortBlobLen {
+		return abbrev[:shortBlobLen]
+	}
+
+	return abbrev
+}
+
+// sameBlob compares blob ids of possibly different lengths
+func sameBlob(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+
+	return strings.HasPrefix(b, a)
+}
+
+// blobID returns git object id of the content
+func blobID(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -2,6 +2,8 @@ package bpi
 
 import (
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -11,12 +13,30 @@ import (
 type Store interface {
 	// List returns N message headers, it will support pagination
 	List() ([]*MessageHeader, error)
-	// Get returns Message by Message-ID
+	// Get returns Message by Message-ID with reviews, comments and quotes from its thread
 	Get(id string) (*Message, error)
+	// Message returns Message by Message-ID without data from its thread
+	Message(id string) (*Message, error)
+	// Reviews returns review trailers from replies to the message by Message-ID
+	Reviews(id string) ([]*Trailer, error)
 	// ThreadCount returns number of messages in thread by Message-ID
 	ThreadCount(id string) (int, error)
 	// Thread returns thread by Message-ID
 	Thread(id string) (*TreeMessage, error)
+	// Series returns patch series the message or its parent belongs to by Message-ID
+	Series(id string) (*Series, error)
+	// Patches returns headers of all patches (except cover letters) ordered by date
+	Patches() ([]*MessageHeader, error)
+	// Raw returns message as it was received by Message-ID
+	Raw(id string) ([]byte, error)
+	// Position returns position of the message in its thread by Message-ID
+	Position(id string) (*Position, error)
+	// Search returns headers of messages matching the query, newest first
+	Search(query string) ([]*MessageHeader, error)
+	// Resolve returns headers of messages a truncated or mangled Message-ID may refer to, newest first
+	Resolve(id string) ([]*MessageHeader, error)
+	// Latest returns header of the newest message or nil if there are no messages
+	Latest() (*MessageHeader, error)
 }
 
 // TreeMessage extends Message with Children and Level
@@ -55,18 +75,64 @@ type MemStore struct {
 	loader  MailLoader
 	idIndex map[string]*MessageHeader
 	tree    map[string]*treeItem
+	series  map[string]*Series
 
 	roots []*MessageHeader
+
+	// dkimKeys enables DKIM verification of messages at ingest
+	dkimKeys *DKIMKeys
+	// developerKeys enables verification of patch attestation on request
+	developerKeys *DeveloperKeys
+	// attestations caches results of attestation verification by Message-ID
+	attestationsMu sync.Mutex
+	attestations   map[string]*Attestation
+
+	// replies caches parts of messages used by their parents by Message-ID
+	repliesMu sync.Mutex
+	replies   map[string]*replyInfo
+}
+
+// repliesCacheSize limits number of messages in the replies cache
+const repliesCacheSize = 10000
+
+// replyInfo contains trailers and quote comments of a message
+type replyInfo struct {
+	trailers []*Trailer
+	comments []*quoteComment
 }
 
 var _ Store = &MemStore{}
 
+// StoreOption configures MemStore
+type StoreOption func(*MemStore)
+
+// WithDKIMKeys enables DKIM verification of messages at ingest using the key cache
+func WithDKIMKeys(keys *DKIMKeys) StoreOption {
+	return func(s *MemStore) {
+		s.dkimKeys = keys
+	}
+}
+
+// WithDeveloperKeys enables verification of patatt attestation of patches on request using the keyring
+func WithDeveloperKeys(keys *DeveloperKeys) StoreOption {
+	return func(s *MemStore) {
+		s.developerKeys = keys
+	}
+}
+
 // NewMemStore creates new MemStore using MailLoader as underlying backend
-func NewMemStore(l MailLoader) (*MemStore, error) {
+func NewMemStore(l MailLoader, opts ...StoreOption) (*MemStore, error) {
 	m := &MemStore{
 		loader:  l,
 		idIndex: make(map[string]*MessageHeader),
 		tree:    make(map[string]*treeItem),
+
+		replies:      make(map[string]*replyInfo),
+		attestations: make(map[string]*Attestation),
+	}
+
+	for _, opt := range opts {
+		opt(m)
 	}
 
 	if err := m.init(); err != nil {
@@ -99,12 +165,12 @@ func (s *MemStore) List() ([]*MessageHeader, error) {
 
 // Get implements Store interface, returns Message by Message-ID
 func (s *MemStore) Get(id string) (*Message, error) {
-	mm, err := s.loader.One(id)
+	ancestors, err := s.ancestors(id)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewMessage(mm)
+	return s.load(id, ancestors)
 }
 
 // ThreadCount implements Store interface, returns number of messages in thread by Message-ID
@@ -137,23 +203,115 @@ func (s *MemStore) Thread(id string) (*TreeMessage, error) {
 		return nil, err
 	}
 
-	return s.toTreeMessage(parent, 0)
+	return s.toTreeMessage(parent, 0, nil)
 }
 
-func (s *MemStore) toTreeMessage(item *treeItem, level int) (*TreeMessage, error) {
-	mm, err := s.loader.One(item.ID)
-	if err != nil {
-		return nil, err
+// Series implements Store interface, returns patch series the message or its parent belongs to by Message-ID
+func (s *MemStore) Series(id string) (*Series, error) {
+	item, ok := s.tree[id]
+	if !ok {
+		return nil, &NotFoundError{Kind: "message", ID: id}
 	}
 
-	m, err := NewMessage(mm)
+	for {
+		if series, ok := s.series[item.ID]; ok {
+			return series, nil
+		}
+
+		if item.Parent == "" {
+			return nil, &NotFoundError{Kind: "series", ID: id}
+		}
+
+		item = s.tree[item.Parent]
+	}
+}
+
+// Patches implements Store interface, returns headers of all patches (except cover letters) ordered by date
+func (s *MemStore) Patches() ([]*MessageHeader, error) {
+	var result []*MessageHeader
+	for _, m := range s.idIndex {
+		if m.Patch != nil && m.Patch.Number > 0 {
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date.Before(result[j].Date)
+	})
+
+	return result, nil
+}
+
+// Latest implements Store interface, returns header of the newest message or nil if there are no messages
+func (s *MemStore) Latest() (*MessageHeader, error) {
+	var result *MessageHeader
+	for _, m := range s.idIndex {
+		if result == nil || m.Date.After(result.Date) {
+			result = m
+		}
+	}
+
+	return result, nil
+}
+
+// Raw implements Store interface, returns message as it was received by Message-ID
+func (s *MemStore) Raw(id string) ([]byte, error) {
+	return s.loader.Raw(id)
+}
+
+// searchLimit is the maximum number of search results
+const searchLimit = 50
+
+// Search implements Store interface, returns headers of messages containing all words of the query
+// in Message-ID or subject, newest first
+func (s *MemStore) Search(query string) ([]*MessageHeader, error) {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var result []*MessageHeader
+	for _, m := range s.idIndex {
+		text := strings.ToLower(m.ID + " " + m.Title)
+
+		found := true
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				found = false
+				break
+			}
+		}
+
+		if found {
+			result = append(result, m)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date.After(result[j].Date)
+	})
+
+	if len(result) > searchLimit {
+		result = result[:searchLimit]
+	}
+
+	return result, nil
+}
+
+// toTreeMessage loads the item with its children,
+// ancestors are loaded messages from the parent to the root
+func (s *MemStore) toTreeMessage(item *treeItem, level int, ancestors []*Message) (*TreeMessage, error) {
+	m, err := s.load(item.ID, ancestors)
 	if err != nil {
 		return nil, err
 	}
 
+	ancestors = append([]*Message{m}, ancestors...)
+	if len(ancestors) > quoteMaxDepth {
+		ancestors = ancestors[:quoteMaxDepth]
+	}
+
 	children := make([]*TreeMessage, len(item.Children))
 	for i, child := range item.Children {
-		tm, err := s.toTreeMessage(child, level+1)
+		tm, err := s.toTreeMessage(child, level+1, ancestors)
 		if err != nil {
 			return nil, err
 		}
@@ -168,10 +326,278 @@ func (s *MemStore) toTreeMessage(item *treeItem, level int) (*TreeMessage, error
 	}, nil
 }
 
+// load loads the message by Message-ID with results of signature verification,
+// reviews and comments from replies and links to quoted ancestors
+func (s *MemStore) load(id string, ancestors []*Message) (*Message, error) {
+	m, err := s.Message(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Reviews, err = s.Reviews(m.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Comments, err = s.comments(m)
+	if err != nil {
+		return nil, err
+	}
+
+	linkQuotes(m, ancestors)
+
+	return m, nil
+}
+
+// Message implements Store interface, returns Message by Message-ID
+// with results of signature verification only
+func (s *MemStore) Message(id string) (*Message, error) {
+	mm, err := s.loader.One(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMessage(mm)
+	if err != nil {
+		return nil, err
+	}
+
+	if h, ok := s.idIndex[m.ID]; ok {
+		m.DKIM = h.DKIM
+	}
+
+	if s.developerKeys != nil && m.Patch != nil {
+		m.Attestation, err = s.attestation(m.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// attestation returns result of attestation verification of the patch by Message-ID,
+// patches are verified on first request because it takes a git call per patch
+func (s *MemStore) attestation(id string) (*Attestation, error) {
+	s.attestationsMu.Lock()
+	result, ok := s.attestations[id]
+	s.attestationsMu.Unlock()
+	if ok {
+		return result, nil
+	}
+
+	raw, err := s.loader.Raw(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "can not load raw message")
+	}
+
+	result = s.developerKeys.Verify(raw)
+
+	s.attestationsMu.Lock()
+	s.attestations[id] = result
+	s.attestationsMu.Unlock()
+
+	return result, nil
+}
+
+// Reviews implements Store interface, collects review trailers from all replies to the message
+// and, for a patch, from replies to the cover letter of its series
+func (s *MemStore) Reviews(id string) ([]*Trailer, error) {
+	item, ok := s.tree[id]
+	if !ok {
+		return nil, nil
+	}
+
+	// skip other patches of the series, replies to them belong to the patches
+	skip := make(map[string]bool)
+	series, inSeries := s.series[id]
+	if inSeries {
+		for _, m := range series.Members() {
+			skip[m.ID] = true
+		}
+	}
+
+	var replies []*treeItem
+	for _, child := range item.Children {
+		replies = append(replies, s.subtree(child, skip)...)
+	}
+
+	if inSeries && series.Cover != nil && series.Cover.ID != id {
+		for _, child := range s.tree[series.Cover.ID].Children {
+			replies = append(replies, s.subtree(child, skip)...)
+		}
+	}
+
+	var result []*Trailer
+	seen := make(map[string]bool)
+	for _, reply := range replies {
+		info, err := s.replyInfo(reply.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, t := range info.trailers {
+			key := strings.ToLower(t.Key + " " + t.Email + " " + t.Name)
+			if t.isReview() && !seen[key] {
+				seen[key] = true
+				result = append(result, t)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// ancestors loads messages the message replies to from the parent up to quoteMaxDepth
+func (s *MemStore) ancestors(id string) ([]*Message, error) {
+	var result []*Message
+	item, ok := s.tree[id]
+	for ok && item.Parent != "" && len(result) < quoteMaxDepth {
+		mm, err := s.loader.One(item.Parent)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := NewMessage(mm)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, m)
+		item, ok = s.tree[item.Parent]
+	}
+
+	return result, nil
+}
+
+// subtree returns the item and all its descendants except skipped subtrees
+func (s *MemStore) subtree(item *treeItem, skip map[string]bool) []*treeItem {
+	var result []*treeItem
+	stack := []*treeItem{item}
+	for {
+		if len(stack) == 0 {
+			break
+		}
+
+		item := stack[0]
+		stack = stack[1:]
+		if skip[item.ID] {
+			continue
+		}
+
+		stack = append(stack, item.Children...)
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// comments maps comments from replies to the patch onto lines of its diffs
+func (s *MemStore) comments(m *Message) ([]*LineComment, error) {
+	item, ok := s.tree[m.ID]
+	if !ok || len(item.Children) == 0 {
+		return nil, nil
+	}
+
+	diffs, err := m.Diffs()
+	if err != nil || len(diffs) == 0 {
+		return nil, nil
+	}
+
+	// skip other patches of the series replying to the message
+	skip := make(map[string]bool)
+	if series, ok := s.series[m.ID]; ok {
+		for _, p := range series.Members() {
+			skip[p.ID] = true
+		}
+	}
+
+	var result []*LineComment
+	for _, child := range item.Children {
+		for _, reply := range s.subtree(child, skip) {
+			info, err := s.replyInfo(reply.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			h := s.idIndex[reply.ID]
+			for _, c := range info.comments {
+				file, hunk, line, ok := findQuotedLine(diffs, c.Quoted)
+				if !ok {
+					continue
+				}
+
+				result = append(result, &LineComment{
+					ID:     reply.ID,
+					Author: h.Author,
+					Date:   h.Date,
+					File:   file,
+					Hunk:   hunk,
+					Line:   line,
+					Text:   c.Text,
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// replyInfo returns trailers and quote comments of the message by Message-ID
+func (s *MemStore) replyInfo(id string) (*replyInfo, error) {
+	s.repliesMu.Lock()
+	info, ok := s.replies[id]
+	s.repliesMu.Unlock()
+	if ok {
+		return info, nil
+	}
+
+	mm, err := s.loader.One(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := NewMessage(mm)
+	if err != nil {
+		return nil, err
+	}
+
+	info = &replyInfo{
+		trailers: m.Trailers,
+		comments: quoteComments(m.Body),
+	}
+
+	s.repliesMu.Lock()
+	if len(s.replies) >= repliesCacheSize {
+		s.replies = make(map[string]*replyInfo)
+	}
+	s.replies[id] = info
+	s.repliesMu.Unlock()
+
+	return info, nil
+}
+
+// verifyDKIM verifies DKIM signatures of all messages
+func (s *MemStore) verifyDKIM() error {
+	for id, m := range s.idIndex {
+		raw, err := s.loader.Raw(id)
+		if err != nil {
+			return errors.Wrap(err, "can not load raw message")
+		}
+
+		domain := m.Author.Address[strings.LastIndexByte(m.Author.Address, '@')+1:]
+		m.DKIM = s.dkimKeys.Verify(raw, domain, m.Date)
+	}
+
+	logrus.Debug("signatures are verified")
+
+	return nil
+}
+
 func (s *MemStore) threadHead(id string) (*treeItem, error) {
 	item, ok := s.tree[id]
 	if !ok {
-		return nil, errors.New("thread head not found")
+		return nil, &NotFoundError{Kind: "message", ID: id}
 	}
 
 	for {
@@ -200,6 +626,12 @@ func (s *MemStore) init() error {
 		s.idIndex[m.ID] = m
 	}
 
+	if s.dkimKeys != nil {
+		if err := s.verifyDKIM(); err != nil {
+			return err
+		}
+	}
+
 	logrus.Debugf("loaded: %d messages", len(s.idIndex))
 
 	// create treeItem for each message
@@ -238,6 +670,9 @@ func (s *MemStore) init() error {
 		})
 	}
 
+	s.series = groupSeries(s.idIndex)
+	linkVersions(s.series)
+
 	logrus.Debug("index is ready")
 
 	return nil
@@ -0,0 +1,144 @@
+package bpi
+
+import (
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+// Trailer represents "Key: Name <email>" line at the end of a commit message
+type Trailer struct {
+	Key   string
+	Name  string
+	Email string
+	// Value is the raw value, the only one set for trailers like "Fixes" or "Link"
+	Value string
+}
+
+// String returns trailer in the same form as in a commit message
+func (t *Trailer) String() string {
+	return t.Key + ": " + t.Value
+}
+
+// Is compares key of the trailer case-insensitively
+func (t *Trailer) Is(key string) bool {
+	return strings.EqualFold(t.Key, key)
+}
+
+// ReviewTrailerKeys are trailers which are collected from replies to a patch
+var ReviewTrailerKeys = []string{"Reviewed-by", "Acked-by", "Tested-by"}
+
+// isReview returns true if the trailer is given by a reviewer
+func (t *Trailer) isReview() bool {
+	for _, key := range ReviewTrailerKeys {
+		if t.Is(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var trailerRe = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*):\s+(\S.*)$`)
+
+// trailerKeys are trailers without "-by" suffix
+var trailerKeys = []string{"Fixes", "Link", "Cc", "Closes", "Message-Id", "Change-Id"}
+
+// parseTrailer returns Trailer if the line is a trailer or nil
+func parseTrailer(line string) *Trailer {
+	m := trailerRe.FindStringSubmatch(strings.TrimRight(line, " \t"))
+	if m == nil {
+		return nil
+	}
+
+	key, value := m[1], m[2]
+	t := &Trailer{Key: key, Value: value}
+
+	withAddress := strings.EqualFold(key, "Cc")
+	if len(key) > 3 && strings.EqualFold(key[len(key)-3:], "-by") {
+		withAddress = true
+	} else if !withAddress {
+		var known bool
+		for _, k := range trailerKeys {
+			if t.Is(k) {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			return nil
+		}
+	}
+
+	if withAddress {
+		addr, err := mail.ParseAddress(value)
+		if err == nil {
+			t.Name = addr.Name
+			t.Email = addr.Address
+		} else {
+			t.Name = value
+		}
+	}
+
+	return t
+}
+
+// SignOffCheck is the result of Developer Certificate of Origin check of a patch
+type SignOffCheck struct {
+	// AuthorSigned is true if there is Signed-off-by of the patch author
+	AuthorSigned bool
+	// SubmitterLast is true if the last Signed-off-by belongs to the sender of the message
+	SubmitterLast bool
+}
+
+// Passed returns true if all checks passed
+func (c *SignOffCheck) Passed() bool {
+	return c.AuthorSigned && c.SubmitterLast
+}
+
+// Reason returns description of the failed check
+func (c *SignOffCheck) Reason() string {
+	switch true {
+	case !c.AuthorSigned:
+		return "no Signed-off-by from the author"
+	case !c.SubmitterLast:
+		return "Signed-off-by of the submitter is not the last one"
+	default:
+		return ""
+	}
+}
+
+// checkSignOff checks Signed-off-by trailers against the patch author and the sender
+func checkSignOff(trailers []*Trailer, author, sender *mail.Address) *SignOffCheck {
+	c := &SignOffCheck{}
+
+	var last *Trailer
+	for _, t := range trailers {
+		if !t.Is("Signed-off-by") {
+			continue
+		}
+
+		if sameAddress(t, author) {
+			c.AuthorSigned = true
+		}
+		last = t
+	}
+
+	c.SubmitterLast = last != nil && sameAddress(last, sender)
+
+	return c
+}
+
+// sameAddress compares trailer with address by email or by name if email is missing
+func sameAddress(t *Trailer, addr *mail.Address) bool {
+	if addr == nil {
+		return false
+	}
+
+	if t.Email != "" && addr.Address != "" {
+		return strings.EqualFold(t.Email, addr.Address)
+	}
+
+	return t.Name != "" && strings.EqualFold(t.Name, addr.Name)
+}
@@ -0,0 +1,31 @@
+package bpi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrailer(t *testing.T) {
+	tests := []struct {
+		line    string
+		trailer *Trailer
+	}{
+		{"Signed-off-by: Alice Dev <alice@example.com>", &Trailer{Key: "Signed-off-by", Name: "Alice Dev", Email: "alice@example.com", Value: "Alice Dev <alice@example.com>"}},
+		{"reviewed-by: bob@example.com  ", &Trailer{Key: "reviewed-by", Email: "bob@example.com", Value: "bob@example.com"}},
+		{"Reported-by: Some Bot", &Trailer{Key: "Reported-by", Name: "Some Bot", Value: "Some Bot"}},
+		{"Cc: Carol <carol@example.com>", &Trailer{Key: "Cc", Name: "Carol", Email: "carol@example.com", Value: "Carol <carol@example.com>"}},
+		{"Fixes: 1234567890ab (\"foo: add baz\")", &Trailer{Key: "Fixes", Value: "1234567890ab (\"foo: add baz\")"}},
+		{"Link: https://lore.kernel.org/r/p1@example.com", &Trailer{Key: "Link", Value: "https://lore.kernel.org/r/p1@example.com"}},
+		{"Note: not a trailer", nil},
+		{"Signed-off-by:", nil},
+		{" Signed-off-by: Alice <alice@example.com>", nil},
+		{"just text", nil},
+	}
+
+	for _, test := range tests {
+		trailer := parseTrailer(test.line)
+		if !reflect.DeepEqual(trailer, test.trailer) {
+			t.Errorf("%q: expected %+v, got %+v", test.line, test.trailer, trailer)
+		}
+	}
+}